@@ -0,0 +1,240 @@
+// Command pluginsdk-harness builds the pluginsdk example plugin and drives
+// it through the real PluginService and HookService in a temporary
+// workforge setup, exiting non-zero when a check fails. Run it from the
+// repository root:
+//
+//	go run ./cmd/pluginsdk-harness
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"workforge/internal/app"
+	"workforge/internal/app/hook"
+	"workforge/internal/app/plugin"
+)
+
+const (
+	pluginName = "sdk-example"
+	exampleDir = "pkg/pluginsdk/example"
+	configKey  = "sdk_example"
+)
+
+type harness struct {
+	dir      string
+	plugins  *plugin.PluginService
+	hooks    *hook.HookService
+	failures int
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "wf-sdk-harness-")
+	if err != nil {
+		fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h, err := setup(dir)
+	if err != nil {
+		fatal(err)
+	}
+	defer h.plugins.KillAll()
+
+	h.check("wakeup", h.wakeup)
+	h.check("on_ping", h.ping)
+	h.check("on_load reply", h.onLoad)
+	h.check("pre_open abort", h.preOpenAbort)
+	h.check("pre_open env", h.preOpenEnv)
+	h.check("on_message notification", h.onMessage)
+	h.check("batch", h.batch)
+	h.check("unknown method", h.unknownMethod)
+	h.check("shutdown", h.shutdown)
+
+	if h.failures > 0 {
+		fmt.Printf("%d check(s) failed\n", h.failures)
+		os.Exit(1)
+	}
+	fmt.Println("all checks passed")
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "harness: %v\n", err)
+	os.Exit(1)
+}
+
+// setup builds the example into an isolated plugins dir and registers it.
+func setup(dir string) (*harness, error) {
+	pluginsDir := filepath.Join(dir, "plugins")
+	pluginDir := filepath.Join(pluginsDir, pluginName)
+	if err := os.MkdirAll(pluginDir, 0o755); err != nil {
+		return nil, err
+	}
+	build := exec.Command("go", "build", "-o", filepath.Join(pluginDir, pluginName), "./"+exampleDir)
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		return nil, fmt.Errorf("build example: %w", err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(exampleDir, "plugin.json"))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(pluginDir, "plugin.json"), manifest, 0o644); err != nil {
+		return nil, err
+	}
+
+	registry := plugin.NewPluginRegistryService(filepath.Join(dir, "plugins.json"))
+	rules := plugin.ManifestRules{Hooks: hook.HookNames(), HostMethods: app.HostMethodNames}
+	installer := plugin.NewPluginInstallerService(pluginsDir, registry, filepath.Join(dir, "plugins.lock"), rules)
+	grantAll := func(string, plugin.Capabilities, *plugin.Capabilities) bool { return true }
+	if err := installer.Register(pluginName, grantAll); err != nil {
+		return nil, err
+	}
+
+	plugins := plugin.NewPluginService(pluginsDir, filepath.Join(dir, "sockets"), registry)
+	return &harness{dir: dir, plugins: plugins, hooks: hook.NewHookService(plugins, registry)}, nil
+}
+
+func (h *harness) check(name string, fn func() error) {
+	start := time.Now()
+	err := fn()
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		h.failures++
+		fmt.Printf("FAIL %s (%s): %v\n", name, elapsed, err)
+		return
+	}
+	fmt.Printf("ok   %s (%s)\n", name, elapsed)
+}
+
+func (h *harness) wakeup() error {
+	return h.plugins.Wakeup(pluginName)
+}
+
+func (h *harness) ping() error {
+	ok, err := h.plugins.Ping(pluginName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("no pong")
+	}
+	return nil
+}
+
+func payload(hookType hook.HookType, cfg map[string]any) *hook.HookPayload {
+	p := hook.NewPayload("harness", hookType)
+	if cfg != nil {
+		p.WithConfig(map[string]any{configKey: cfg})
+	}
+	return p
+}
+
+// only returns the single result of running p, failing on plugin errors.
+func (h *harness) only(p *hook.HookPayload) (hook.HookResult, error) {
+	results := h.hooks.Run(p)
+	if len(results) != 1 {
+		return hook.HookResult{}, fmt.Errorf("got %d results, want 1", len(results))
+	}
+	return results[0], results[0].Error
+}
+
+func (h *harness) onLoad() error {
+	r, err := h.only(payload(hook.HookOnLoad, map[string]any{"greeting": "Welcome"}))
+	if err != nil {
+		return err
+	}
+	if want := "Welcome, harness"; r.Response != want {
+		return fmt.Errorf("reply %q, want %q", r.Response, want)
+	}
+	return nil
+}
+
+func (h *harness) preOpenAbort() error {
+	p := payload(hook.HookPreOpen, map[string]any{"protect": []string{"main"}}).
+		WithField(hook.FieldBranch, "main")
+	r, err := h.only(p)
+	if err != nil {
+		return err
+	}
+	_, err = hook.Merge(hook.HookPreOpen, []hook.HookResult{r})
+	var abort hook.AbortError
+	if !errors.As(err, &abort) {
+		return fmt.Errorf("got %v, want an abort", err)
+	}
+	return nil
+}
+
+func (h *harness) preOpenEnv() error {
+	p := payload(hook.HookPreOpen, nil).WithField(hook.FieldBranch, "feature")
+	r, err := h.only(p)
+	if err != nil {
+		return err
+	}
+	out, err := hook.Merge(hook.HookPreOpen, []hook.HookResult{r})
+	if err != nil {
+		return err
+	}
+	if out.Env["SDK_EXAMPLE_BRANCH"] != "feature" {
+		return fmt.Errorf("env %v, want SDK_EXAMPLE_BRANCH=feature", out.Env)
+	}
+	return nil
+}
+
+func (h *harness) onMessage() error {
+	h.hooks.Notify(payload(hook.HookOnMessage, nil).WithMessage("from the harness"))
+	// A notification gets no answer; the plugin must still serve calls.
+	return h.ping()
+}
+
+func (h *harness) batch() error {
+	calls := []plugin.BatchCall{
+		{Method: "on_ping"},
+		{Method: string(hook.HookOnHealthcheck), Params: map[string]any{"project": "harness"}},
+	}
+	results, err := h.plugins.CallBatch(pluginName, calls)
+	if err != nil {
+		return err
+	}
+	for i, r := range results {
+		if r.Error != nil {
+			return fmt.Errorf("call %d: %w", i, r.Error)
+		}
+	}
+	if string(results[1].Result) != `{"message":"ok"}` {
+		return fmt.Errorf("healthcheck result %s", results[1].Result)
+	}
+	return nil
+}
+
+func (h *harness) unknownMethod() error {
+	if _, err := h.plugins.Call(pluginName, "on_nothing", nil); err == nil {
+		return errors.New("unknown method succeeded")
+	}
+	return nil
+}
+
+// shutdown asks the plugin to stop and waits for it to remove its socket,
+// which the SDK does once running handlers are done.
+func (h *harness) shutdown() error {
+	if _, err := h.plugins.Call(pluginName, "shutdown", nil); err != nil {
+		return err
+	}
+	socket := filepath.Join(h.dir, "sockets", pluginName+".sock")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(socket); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("socket %s still there after shutdown", socket)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return h.plugins.Kill(pluginName)
+}
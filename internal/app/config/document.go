@@ -0,0 +1,326 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a .wfconfig.yml kept as a yaml.v3 node tree so that edits
+// preserve comments and key order.
+type Document struct {
+	root *yaml.Node
+}
+
+func (s *ConfigService) LoadDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDocument(data)
+}
+
+func ParseDocument(data []byte) (*Document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	return &Document{root: &root}, nil
+}
+
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Get returns the node at a dotted path such as "default.tmux.windows[0]".
+func (d *Document) Get(path string) (*yaml.Node, error) {
+	keys, err := splitPath(path)
+	if err != nil {
+		return nil, err
+	}
+	n := d.root.Content[0]
+	for i, key := range keys {
+		next, err := child(n, key)
+		if err != nil {
+			return nil, err
+		}
+		if next == nil {
+			return nil, fmt.Errorf("%s: not set", joinPath(keys[:i+1]))
+		}
+		n = next
+	}
+	return n, nil
+}
+
+// Set parses value as YAML and stores it at path, creating intermediate
+// mappings as needed. An index equal to the list length appends.
+func (d *Document) Set(path string, value string) error {
+	keys, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return fmt.Errorf("parse value: %w", err)
+	}
+	newNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: ""}
+	if len(parsed.Content) > 0 {
+		newNode = parsed.Content[0]
+		newNode.Style &^= yaml.FlowStyle
+	}
+
+	n := d.root.Content[0]
+	for i, key := range keys {
+		last := i == len(keys)-1
+		if idx, isIndex := key.(int); isIndex {
+			if n.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s: not a list", joinPath(keys[:i]))
+			}
+			switch {
+			case idx < len(n.Content) && last:
+				newNode.HeadComment = n.Content[idx].HeadComment
+				newNode.LineComment = n.Content[idx].LineComment
+				n.Content[idx] = newNode
+			case idx < len(n.Content):
+				n = n.Content[idx]
+			case idx == len(n.Content):
+				if last {
+					n.Content = append(n.Content, newNode)
+					break
+				}
+				m := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				n.Content = append(n.Content, m)
+				n = m
+			default:
+				return fmt.Errorf("%s: index %d out of range", joinPath(keys[:i]), idx)
+			}
+			continue
+		}
+
+		name := key.(string)
+		if n.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: not a mapping", joinPath(keys[:i]))
+		}
+		pos := -1
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Value == name {
+				pos = j + 1
+				break
+			}
+		}
+		if last {
+			if pos >= 0 {
+				newNode.LineComment = n.Content[pos].LineComment
+				n.Content[pos] = newNode
+			} else {
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, newNode)
+			}
+			break
+		}
+		if pos < 0 {
+			next := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if _, nextIsIndex := keys[i+1].(int); nextIsIndex {
+				next = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, next)
+			n = next
+			continue
+		}
+		n = n.Content[pos]
+	}
+	return nil
+}
+
+// ErrInvalidConfig is returned when a write is refused because validation failed.
+var ErrInvalidConfig = errors.New("config has validation errors")
+
+// SaveDocument validates doc and writes it to path only if it has no errors.
+func (s *ConfigService) SaveDocument(path string, doc *Document, plugins []PluginSection) ([]Issue, error) {
+	data, err := doc.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	issues := s.Validate(data, plugins)
+	if HasErrors(issues) {
+		return issues, ErrInvalidConfig
+	}
+	return issues, os.WriteFile(path, data, 0o644)
+}
+
+// FormatNode renders scalars as their plain value and anything else as YAML.
+func FormatNode(n *yaml.Node) (string, error) {
+	if n.Kind == yaml.ScalarNode {
+		return n.Value, nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	enc.Close()
+	return strings.TrimRight(buf.String(), "\n"), nil
+}
+
+func child(n *yaml.Node, key any) (*yaml.Node, error) {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	switch k := key.(type) {
+	case int:
+		if n.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("[%d]: not a list", k)
+		}
+		if k >= len(n.Content) {
+			return nil, nil
+		}
+		return n.Content[k], nil
+	default:
+		if n.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: parent is not a mapping", k)
+		}
+		for j := 0; j+1 < len(n.Content); j += 2 {
+			if n.Content[j].Value == k {
+				return n.Content[j+1], nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+// splitPath turns "a.b[1].c" into ["a", "b", 1, "c"].
+func splitPath(path string) ([]any, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var keys []any
+	for _, part := range strings.Split(path, ".") {
+		name := part
+		var indexes []int
+		for strings.HasSuffix(name, "]") {
+			open := strings.LastIndexByte(name, '[')
+			if open < 0 {
+				return nil, fmt.Errorf("invalid path %q", path)
+			}
+			idx, err := strconv.Atoi(name[open+1 : len(name)-1])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid index in %q", part)
+			}
+			indexes = append([]int{idx}, indexes...)
+			name = name[:open]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		keys = append(keys, name)
+		for _, idx := range indexes {
+			keys = append(keys, idx)
+		}
+	}
+	return keys, nil
+}
+
+func joinPath(keys []any) string {
+	var b strings.Builder
+	for _, k := range keys {
+		switch v := k.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", v)
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(v.(string))
+		}
+	}
+	return b.String()
+}
+
+// Templates are the starter configs offered by `wf config init --template`.
+var Templates = map[string]string{
+	"default": ExampleConfigYAML,
+	"minimal": `default:
+  # Command run when no tmux section is present
+  foreground: "nvim ."
+`,
+	"go": `default:
+  log_level: "INFO"
+  hooks:
+    on_load:
+      - "go mod download"
+  tmux:
+    attach: true
+    session_name: "${project}"
+    windows:
+      - "nvim ."
+      - "go test ./..."
+`,
+	"node": `default:
+  log_level: "INFO"
+  hooks:
+    on_load:
+      - "npm ci"
+  tmux:
+    attach: true
+    session_name: "${project}"
+    windows:
+      - "nvim ."
+      - "npm run dev"
+`,
+}
+
+func TemplateNames() []string {
+	names := make([]string, 0, len(Templates))
+	for name := range Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteTemplate writes the named starter config into dir, refusing to
+// overwrite an existing file unless force is set.
+func (s *ConfigService) WriteTemplate(dir string, name string, force bool) (string, error) {
+	content, ok := Templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown template %q (available: %s)", name, strings.Join(TemplateNames(), ", "))
+	}
+	path := s.ResolveConfigPath(dir, false)
+	if _, err := os.Stat(path); err == nil && !force {
+		return "", fmt.Errorf("%s already exists (use --force to overwrite)", path)
+	}
+	return path, os.WriteFile(path, []byte(strings.TrimLeft(content, "\n")), 0o644)
+}
+
+// TemplateValues returns tpl as generic values keyed like .wfconfig.yml,
+// ready to be encoded as JSON.
+func TemplateValues(tpl Template) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(tpl)
+	if err != nil {
+		return nil, fmt.Errorf("encode template: %w", err)
+	}
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("decode template: %w", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	EnvProject  = "WF_PROJECT"
+	EnvBranch   = "WF_BRANCH"
+	EnvWorktree = "WF_WORKTREE"
+	EnvProfile  = "WF_PROFILE"
+
+	// Set for on_error, on_warning and on_message commands.
+	EnvHook    = "WF_HOOK"
+	EnvMessage = "WF_MESSAGE"
+	EnvContext = "WF_CONTEXT"
+)
+
+// ResolveEnv builds the environment added to hook commands, the foreground
+// command and tmux windows. Later sources win: env_files in order, then
+// env, then the reserved WF_* variables. tpl must already be expanded.
+func (s *ConfigService) ResolveEnv(tpl Template, scope Scope) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, file := range tpl.EnvFiles {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(scope.Root, path)
+		}
+		vars, err := LoadDotenv(path)
+		if err != nil {
+			return nil, fmt.Errorf("env_files: %w", err)
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+	}
+	for k, v := range tpl.Env {
+		env[k] = v
+	}
+	env[EnvProject] = scope.Project
+	env[EnvBranch] = scope.Branch
+	env[EnvWorktree] = scope.Worktree
+	env[EnvProfile] = scope.Profile
+	return env, nil
+}
+
+// IsReservedEnv reports whether key is one of the WF_* variables wf sets
+// itself.
+func IsReservedEnv(key string) bool {
+	switch key {
+	case EnvProject, EnvBranch, EnvWorktree, EnvProfile:
+		return true
+	}
+	return false
+}
+
+func LoadDotenv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vars, err := ParseDotenv(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// ParseDotenv reads KEY=VALUE lines. Blank lines, `#` comments and an
+// optional `export ` prefix are allowed; values may be single- or
+// double-quoted.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = unescapeDoubleQuoted(value[1 : len(value)-1])
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+func unescapeDoubleQuoted(s string) string {
+	r := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+	return r.Replace(s)
+}
+
+// EnvList renders env as sorted KEY=VALUE pairs for os/exec and tmux.
+func EnvList(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = k + "=" + env[k]
+	}
+	return out
+}
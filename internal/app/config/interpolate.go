@@ -0,0 +1,366 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"workforge/internal/util"
+)
+
+const (
+	VarProject  = "project"
+	VarBranch   = "branch"
+	VarWorktree = "worktree"
+	VarRoot     = "root"
+	VarProfile  = "profile"
+
+	envVarPrefix = "env:"
+)
+
+// Scope holds the built-in values available to `${...}` references.
+type Scope struct {
+	Project  string
+	Branch   string
+	Worktree string
+	Root     string
+	Profile  string
+}
+
+func (s Scope) builtins() map[string]string {
+	return map[string]string{
+		VarProject:  s.Project,
+		VarBranch:   s.Branch,
+		VarWorktree: s.Worktree,
+		VarRoot:     s.Root,
+		VarProfile:  s.Profile,
+	}
+}
+
+type UndefinedVariableError struct {
+	Name  string
+	Field string
+	// Suggestion is the defined name closest to Name, if any.
+	Suggestion string
+}
+
+func (e UndefinedVariableError) Error() string {
+	msg := fmt.Sprintf("undefined variable ${%s} in %s", e.Name, e.Field)
+	if e.Suggestion != "" {
+		return msg + fmt.Sprintf(" (did you mean ${%s}?)", e.Suggestion)
+	}
+	if !strings.HasPrefix(e.Name, envVarPrefix) {
+		return msg + fmt.Sprintf("; write $${%s} for a shell variable", e.Name)
+	}
+	return msg
+}
+
+type CircularVariableError struct {
+	Name string
+}
+
+func (e CircularVariableError) Error() string {
+	return fmt.Sprintf("vars.%s: circular reference", e.Name)
+}
+
+// nestedError carries an already-attributed error out of a nested var resolution.
+type nestedError struct {
+	err error
+}
+
+func (e nestedError) Error() string {
+	return e.err.Error()
+}
+
+type Interpolator struct {
+	values map[string]string
+	// known is every built-in and user-defined name, for suggestions.
+	known []string
+}
+
+// NewInterpolator resolves the user-defined vars against the built-in scope.
+// Vars may reference built-ins, env vars and each other.
+func NewInterpolator(scope Scope, vars map[string]string) (*Interpolator, error) {
+	in := &Interpolator{values: scope.builtins()}
+	for name := range in.values {
+		in.known = append(in.known, name)
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if _, builtin := in.values[name]; builtin {
+			return nil, fmt.Errorf("vars.%s: cannot override built-in variable", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	in.known = append(in.known, names...)
+	sort.Strings(in.known)
+
+	resolving := make(map[string]bool)
+	var resolve func(name string) error
+	resolve = func(name string) error {
+		if _, done := in.values[name]; done {
+			return nil
+		}
+		if resolving[name] {
+			return CircularVariableError{Name: name}
+		}
+		resolving[name] = true
+		out, err := expand(vars[name], func(ref string) (string, bool, error) {
+			if _, user := vars[ref]; user {
+				if err := resolve(ref); err != nil {
+					return "", false, nestedError{err: err}
+				}
+			}
+			v, ok := in.lookup(ref)
+			return v, ok, nil
+		})
+		if err != nil {
+			return in.suggest(wrapField(err, "vars."+name))
+		}
+		in.values[name] = out
+		delete(resolving, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// Expand replaces every `${name}` in s. `$${` escapes a literal `${`.
+// Upper-case names wf does not define are left for the shell, e.g.
+// `${HOME}`; an undefined lower-case or dotted name is an error.
+func (in *Interpolator) Expand(s string, field string) (string, error) {
+	out, err := expand(s, func(ref string) (string, bool, error) {
+		v, ok := in.lookup(ref)
+		return v, ok, nil
+	})
+	if err != nil {
+		return "", in.suggest(wrapField(err, field))
+	}
+	return out, nil
+}
+
+// suggest adds the closest known name to an UndefinedVariableError.
+func (in *Interpolator) suggest(err error) error {
+	e, ok := err.(UndefinedVariableError)
+	if !ok || e.Suggestion != "" || strings.HasPrefix(e.Name, envVarPrefix) {
+		return err
+	}
+	// vars are referenced by their bare name, not as ${vars.name}.
+	e.Suggestion = util.Closest(strings.TrimPrefix(e.Name, "vars."), in.known)
+	return e
+}
+
+func (in *Interpolator) ExpandAll(items []string, field string) ([]string, error) {
+	if items == nil {
+		return nil, nil
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		v, err := in.Expand(item, fmt.Sprintf("%s[%d]", field, i))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (in *Interpolator) expandCondition(c Condition, field string) (*Condition, error) {
+	var err error
+	for _, f := range []struct {
+		name string
+		v    *string
+	}{
+		{"exists", &c.Exists},
+		{"missing", &c.Missing},
+		{"branch", &c.Branch},
+		{"command", &c.Command},
+	} {
+		if *f.v, err = in.Expand(*f.v, field+"."+f.name); err != nil {
+			return nil, err
+		}
+	}
+	if c.Newer != nil {
+		newer := *c.Newer
+		if newer.File, err = in.Expand(newer.File, field+".newer.file"); err != nil {
+			return nil, err
+		}
+		if newer.Than, err = in.Expand(newer.Than, field+".newer.than"); err != nil {
+			return nil, err
+		}
+		c.Newer = &newer
+	}
+	return &c, nil
+}
+
+func (in *Interpolator) lookup(name string) (string, bool) {
+	if strings.HasPrefix(name, envVarPrefix) {
+		return os.LookupEnv(strings.TrimPrefix(name, envVarPrefix))
+	}
+	v, ok := in.values[name]
+	return v, ok
+}
+
+func expand(s string, lookup func(string) (string, bool, error)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ at offset %d", i)
+		}
+		name := strings.TrimSpace(s[i+2 : i+2+end])
+		v, ok, err := lookup(name)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case ok:
+			b.WriteString(v)
+		case strings.HasPrefix(name, envVarPrefix), !shellName(name):
+			return "", UndefinedVariableError{Name: name}
+		default:
+			b.WriteString(s[i : i+end+3])
+		}
+		i += end + 3
+	}
+	return b.String(), nil
+}
+
+// shellName reports whether an undefined `${...}` reference belongs to the
+// shell: it starts with an upper-case environment name, like `${HOME}` or
+// `${PORT:-8080}`, or with shell syntax, like `${#ARGS[@]}`. Lower-case
+// and dotted names are wf's own.
+func shellName(name string) bool {
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r == '.':
+			return false
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+func wrapField(err error, field string) error {
+	switch e := err.(type) {
+	case nestedError:
+		return e.err
+	case CircularVariableError:
+		return e
+	case UndefinedVariableError:
+		if e.Field == "" {
+			e.Field = field
+		}
+		return e
+	}
+	return fmt.Errorf("%s: %w", field, err)
+}
+
+// ExpandTemplate returns a copy of tpl with hooks, foreground, env, tasks and
+// tmux fields interpolated against scope and tpl.Vars.
+func (s *ConfigService) ExpandTemplate(tpl Template, scope Scope) (Template, error) {
+	in, err := NewInterpolator(scope, tpl.Vars)
+	if err != nil {
+		return Template{}, err
+	}
+
+	out := tpl
+	if out.Foreground, err = in.Expand(tpl.Foreground, "foreground"); err != nil {
+		return Template{}, err
+	}
+
+	if out.EnvFiles, err = in.ExpandAll(tpl.EnvFiles, "env_files"); err != nil {
+		return Template{}, err
+	}
+	if tpl.Env != nil {
+		out.Env = make(map[string]string, len(tpl.Env))
+		for k, v := range tpl.Env {
+			if out.Env[k], err = in.Expand(v, "env."+k); err != nil {
+				return Template{}, err
+			}
+		}
+	}
+
+	for _, h := range out.Hooks.named() {
+		src := *h.commands
+		if src == nil {
+			continue
+		}
+		expanded := make([]Command, len(src))
+		for i, c := range src {
+			expanded[i] = c
+			field := fmt.Sprintf("hooks.%s[%d]", h.name, i)
+			if expanded[i].Run, err = in.Expand(c.Run, field); err != nil {
+				return Template{}, err
+			}
+			if expanded[i].Inputs, err = in.ExpandAll(c.Inputs, field+".inputs"); err != nil {
+				return Template{}, err
+			}
+			if c.If != nil {
+				if expanded[i].If, err = in.expandCondition(*c.If, field+".if"); err != nil {
+					return Template{}, err
+				}
+			}
+		}
+		*h.commands = expanded
+	}
+
+	if tpl.Tasks != nil {
+		out.Tasks = make(map[string]Task, len(tpl.Tasks))
+		for name, task := range tpl.Tasks {
+			field := "tasks." + name
+			expanded := task
+			if expanded.Commands, err = in.ExpandAll(task.Commands, field+".commands"); err != nil {
+				return Template{}, err
+			}
+			if expanded.Dir, err = in.Expand(task.Dir, field+".dir"); err != nil {
+				return Template{}, err
+			}
+			if task.Env != nil {
+				expanded.Env = make(map[string]string, len(task.Env))
+				for k, v := range task.Env {
+					if expanded.Env[k], err = in.Expand(v, field+".env."+k); err != nil {
+						return Template{}, err
+					}
+				}
+			}
+			out.Tasks[name] = expanded
+		}
+	}
+
+	if tpl.Tmux != nil {
+		tmuxCfg := *tpl.Tmux
+		if tmuxCfg.SessionName, err = in.Expand(tpl.Tmux.SessionName, "tmux.session_name"); err != nil {
+			return Template{}, err
+		}
+		if tmuxCfg.Windows, err = in.ExpandAll(tpl.Tmux.Windows, "tmux.windows"); err != nil {
+			return Template{}, err
+		}
+		out.Tmux = &tmuxCfg
+	}
+
+	return out, nil
+}
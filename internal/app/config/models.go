@@ -1,5 +1,11 @@
 package config
 
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 const ConfigFileName = ".wfconfig.yml"
 const DefaultProfile = "default"
 const ExampleConfigYAML = `
@@ -25,18 +31,134 @@ type Config = map[string]Template
 type Template struct {
 	LogLevel   string                 `yaml:"log_level,omitempty"`
 	Foreground string                 `yaml:"foreground,omitempty"`
+	Vars       map[string]string      `yaml:"vars,omitempty"`
+	Match      *Match                 `yaml:"match,omitempty"`
+	Env        map[string]string      `yaml:"env,omitempty"`
+	EnvFiles   []string               `yaml:"env_files,omitempty"`
+	Tasks      map[string]Task        `yaml:"tasks,omitempty"`
 	Hooks      Hooks                  `yaml:"hooks,omitempty"`
 	Tmux       *Tmux                  `yaml:"tmux,omitempty"`
 	Extras     map[string]interface{} `yaml:",inline"`
 }
 
+// Match makes a profile apply automatically when every set pattern matches.
+type Match struct {
+	Branch string `yaml:"branch,omitempty"`
+	Path   string `yaml:"path,omitempty"`
+}
+
 type Hooks struct {
-	OnCreate      []string `yaml:"on_create,omitempty"`
-	OnLoad        []string `yaml:"on_load,omitempty"`
-	OnClose       []string `yaml:"on_close,omitempty"`
-	OnDelete      []string `yaml:"on_delete,omitempty"`
-	OnShellRunIn  []string `yaml:"on_shell_run_in,omitempty"`
-	OnShellRunOut []string `yaml:"on_shell_run_out,omitempty"`
+	Timeout       map[string]time.Duration `yaml:"timeout,omitempty"`
+	OnCreate      []Command                `yaml:"on_create,omitempty"`
+	OnLoad        []Command                `yaml:"on_load,omitempty"`
+	OnClose       []Command                `yaml:"on_close,omitempty"`
+	OnDelete      []Command                `yaml:"on_delete,omitempty"`
+	OnShellRunIn  []Command                `yaml:"on_shell_run_in,omitempty"`
+	OnShellRunOut []Command                `yaml:"on_shell_run_out,omitempty"`
+	OnError       []Command                `yaml:"on_error,omitempty"`
+	OnWarning     []Command                `yaml:"on_warning,omitempty"`
+	OnMessage     []Command                `yaml:"on_message,omitempty"`
+}
+
+type namedHook struct {
+	name     string
+	commands *[]Command
+}
+
+func (h *Hooks) named() []namedHook {
+	return []namedHook{
+		{"on_create", &h.OnCreate},
+		{"on_load", &h.OnLoad},
+		{"on_close", &h.OnClose},
+		{"on_delete", &h.OnDelete},
+		{"on_shell_run_in", &h.OnShellRunIn},
+		{"on_shell_run_out", &h.OnShellRunOut},
+		{"on_error", &h.OnError},
+		{"on_warning", &h.OnWarning},
+		{"on_message", &h.OnMessage},
+	}
+}
+
+// Get returns the commands configured for a hook name such as "on_load".
+func (h Hooks) Get(name string) []Command {
+	for _, nh := range h.named() {
+		if nh.name == name {
+			return *nh.commands
+		}
+	}
+	return nil
+}
+
+// Command is a hook entry, written either as a plain string or as an
+// object with `run:` and options. Entries run in order unless they are
+// marked parallel or background, or name their dependencies explicitly.
+type Command struct {
+	Run             string        `yaml:"run"`
+	Name            string        `yaml:"name,omitempty"`
+	Timeout         time.Duration `yaml:"timeout,omitempty"`
+	Parallel        bool          `yaml:"parallel,omitempty"`
+	Background      bool          `yaml:"background,omitempty"`
+	DependsOn       []string      `yaml:"depends_on,omitempty"`
+	ContinueOnError bool          `yaml:"continue_on_error,omitempty"`
+	If              *Condition    `yaml:"if,omitempty"`
+	Once            bool          `yaml:"once,omitempty"`
+	Inputs          []string      `yaml:"inputs,omitempty"`
+}
+
+func (c *Command) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		*c = Command{Run: n.Value}
+		return nil
+	}
+	type plain Command
+	return n.Decode((*plain)(c))
+}
+
+func (c Command) MarshalYAML() (interface{}, error) {
+	if c.isPlain() {
+		return c.Run, nil
+	}
+	type plain Command
+	return plain(c), nil
+}
+
+// isPlain reports whether c can be written back as a plain string.
+func (c Command) isPlain() bool {
+	return c.Name == "" && c.Timeout == 0 && !c.Parallel && !c.Background &&
+		len(c.DependsOn) == 0 && !c.ContinueOnError && c.If == nil && !c.Once &&
+		len(c.Inputs) == 0
+}
+
+// Concurrent reports whether c may run alongside other entries of its hook.
+func (c Command) Concurrent() bool {
+	return c.Parallel || c.Background || len(c.DependsOn) > 0
+}
+
+// Condition gates a hook entry; every field that is set must hold. Paths
+// are relative to the worktree.
+type Condition struct {
+	Exists  string `yaml:"exists,omitempty"`
+	Missing string `yaml:"missing,omitempty"`
+	Newer   *Newer `yaml:"newer,omitempty"`
+	Branch  string `yaml:"branch,omitempty"`
+	Env     string `yaml:"env,omitempty"`
+	Command string `yaml:"command,omitempty"`
+}
+
+// Newer holds when File was modified after Than, or Than does not exist.
+type Newer struct {
+	File string `yaml:"file"`
+	Than string `yaml:"than"`
+}
+
+// Task is a named command list runnable with `wf task` or as a tmux window
+// command written as "task:<name>".
+type Task struct {
+	Description string            `yaml:"description,omitempty"`
+	Commands    []string          `yaml:"commands,omitempty"`
+	DependsOn   []string          `yaml:"depends_on,omitempty"`
+	Dir         string            `yaml:"dir,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
 }
 
 type Tmux struct {
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MatchTarget is what `match:` patterns are evaluated against.
+type MatchTarget struct {
+	Branch string
+	Path   string
+}
+
+type ProfileSelection struct {
+	Name    string
+	Reason  string
+	Details []string
+}
+
+func (s *ConfigService) SelectProfile(cfg Config, requested *string, target MatchTarget) (ProfileSelection, error) {
+	if requested != nil && *requested != "" {
+		if _, ok := cfg[*requested]; !ok {
+			return ProfileSelection{}, fmt.Errorf("profile %q not found", *requested)
+		}
+		return ProfileSelection{Name: *requested, Reason: "requested with --profile"}, nil
+	}
+	if len(cfg) == 0 {
+		return ProfileSelection{}, fmt.Errorf("no profiles defined in config")
+	}
+
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var details []string
+	why := make(map[string]string)
+	var unconditional []string
+	var best []string
+	bestScore := 0
+	for _, name := range names {
+		m := cfg[name].Match
+		if m == nil {
+			unconditional = append(unconditional, name)
+			continue
+		}
+		score, explanation := m.evaluate(target)
+		why[name] = explanation
+		details = append(details, fmt.Sprintf("%s: %s", name, explanation))
+		switch {
+		case score == 0:
+		case score > bestScore:
+			best, bestScore = []string{name}, score
+		case score == bestScore:
+			best = append(best, name)
+		}
+	}
+
+	switch {
+	case len(best) == 1:
+		return ProfileSelection{Name: best[0], Reason: "match rule: " + why[best[0]], Details: details}, nil
+	case len(best) > 1:
+		return ProfileSelection{Details: details}, fmt.Errorf("profiles %s all match equally; specify --profile", strings.Join(best, ", "))
+	}
+
+	if len(unconditional) == 0 {
+		return ProfileSelection{Details: details}, fmt.Errorf("no profile matches the current worktree; specify --profile")
+	}
+	if len(unconditional) == 1 {
+		return ProfileSelection{Name: unconditional[0], Reason: "only profile without a match rule", Details: details}, nil
+	}
+	if _, ok := cfg[DefaultProfile]; ok && cfg[DefaultProfile].Match == nil {
+		return ProfileSelection{Name: DefaultProfile, Reason: "no match rule applied; using default", Details: details}, nil
+	}
+	return ProfileSelection{Details: details}, fmt.Errorf("multiple profiles defined; specify --profile")
+}
+
+// evaluate returns how many patterns matched (0 if any set pattern fails)
+// and a human-readable explanation.
+func (m *Match) evaluate(target MatchTarget) (int, string) {
+	if m.Branch == "" && m.Path == "" {
+		return 0, "empty match rule"
+	}
+	var parts []string
+	score := 0
+	ok := true
+	if m.Branch != "" {
+		if matchGlob(m.Branch, target.Branch) {
+			score++
+			parts = append(parts, fmt.Sprintf("branch %q matches %q", target.Branch, m.Branch))
+		} else {
+			ok = false
+			parts = append(parts, fmt.Sprintf("branch %q does not match %q", target.Branch, m.Branch))
+		}
+	}
+	if m.Path != "" {
+		subject := target.Path
+		if !strings.Contains(m.Path, "/") {
+			subject = filepath.Base(target.Path)
+		}
+		if matchGlob(m.Path, subject) {
+			score++
+			parts = append(parts, fmt.Sprintf("path %q matches %q", subject, m.Path))
+		} else {
+			ok = false
+			parts = append(parts, fmt.Sprintf("path %q does not match %q", subject, m.Path))
+		}
+	}
+	if !ok {
+		return 0, strings.Join(parts, ", ")
+	}
+	return score, strings.Join(parts, ", ")
+}
+
+func matchGlob(pattern, value string) bool {
+	if value == "" {
+		return false
+	}
+	ok, err := path.Match(pattern, value)
+	return err == nil && ok
+}
@@ -0,0 +1,293 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"workforge/internal/infra/log"
+)
+
+type Kind string
+
+const (
+	KindString Kind = "string"
+	KindBool   Kind = "boolean"
+	KindList   Kind = "array"
+	KindMap    Kind = "map"
+	KindObject Kind = "object"
+	// KindUnion accepts whichever variant matches the node's shape.
+	KindUnion Kind = "union"
+)
+
+// Field describes one key of .wfconfig.yml. The same description drives
+// `wf config validate` and `wf config schema`.
+type Field struct {
+	Name        string
+	Kind        Kind
+	Description string
+	Enum        []string
+	Elem        *Field
+	Fields      []Field
+	Variants    []Field
+	Required    bool
+	Check       func(value string) error
+}
+
+func (f Field) lookup(name string) (Field, bool) {
+	for _, sub := range f.Fields {
+		if sub.Name == name {
+			return sub, true
+		}
+	}
+	return Field{}, false
+}
+
+func (f Field) fieldNames() []string {
+	names := make([]string, len(f.Fields))
+	for i, sub := range f.Fields {
+		names[i] = sub.Name
+	}
+	return names
+}
+
+var stringList = &Field{Kind: KindString}
+
+var durationField = Field{Kind: KindString, Description: "Duration such as 30s or 5m", Check: checkDuration}
+
+// CommandSchema describes a hook entry: a shell string or an object.
+var CommandSchema = Field{
+	Kind: KindUnion,
+	Variants: []Field{
+		{Kind: KindString, Description: "Shell command"},
+		{
+			Kind:        KindObject,
+			Description: "Shell command with options",
+			Fields: []Field{
+				{Name: "run", Kind: KindString, Description: "Shell command", Required: true},
+				{Name: "name", Kind: KindString, Description: "Label used in output and depends_on"},
+				withName(durationField, "timeout", "Kill the command after this long"),
+				{Name: "parallel", Kind: KindBool, Description: "Run together with the neighbouring parallel entries"},
+				{Name: "background", Kind: KindBool, Description: "Start detached without waiting; keeps running after wf exits until wf close"},
+				{Name: "depends_on", Kind: KindList, Description: "Names of entries that must finish first", Elem: stringList},
+				{Name: "continue_on_error", Kind: KindBool, Description: "Keep going when this command fails"},
+				{
+					Name:        "if",
+					Kind:        KindObject,
+					Description: "Run only when every condition holds",
+					Fields: []Field{
+						{Name: "exists", Kind: KindString, Description: "Path that must exist"},
+						{Name: "missing", Kind: KindString, Description: "Path that must not exist"},
+						{
+							Name:        "newer",
+							Kind:        KindObject,
+							Description: "file must be modified after than, or than must be missing",
+							Fields: []Field{
+								{Name: "file", Kind: KindString, Required: true},
+								{Name: "than", Kind: KindString, Required: true},
+							},
+						},
+						{Name: "branch", Kind: KindString, Description: "Glob matched against the current branch", Check: checkGlob},
+						{Name: "env", Kind: KindString, Description: "Environment variable that must be set and non-empty"},
+						{Name: "command", Kind: KindString, Description: "Shell command that must succeed"},
+					},
+				},
+				{Name: "once", Kind: KindBool, Description: "Run only until it first succeeds in this worktree"},
+				{Name: "inputs", Kind: KindList, Description: "Globs hashed to skip the command when unchanged since its last success", Elem: &Field{Kind: KindString, Check: checkGlob}},
+			},
+		},
+	},
+}
+
+func withName(f Field, name, desc string) Field {
+	f.Name = name
+	f.Description = desc
+	return f
+}
+
+func hookField(name, desc string) Field {
+	return Field{Name: name, Kind: KindList, Description: desc, Elem: &CommandSchema}
+}
+
+// TemplateSchema describes a single profile.
+var TemplateSchema = Field{
+	Kind:        KindObject,
+	Description: "Workforge profile",
+	Fields: []Field{
+		{
+			Name:        "log_level",
+			Kind:        KindString,
+			Description: "Log verbosity for this profile",
+			Enum:        log.LevelNames,
+			Check:       checkLogLevel,
+		},
+		{Name: "foreground", Kind: KindString, Description: "Command run in the foreground when tmux is not configured"},
+		{
+			Name:        "match",
+			Kind:        KindObject,
+			Description: "Select this profile automatically when all patterns match",
+			Fields: []Field{
+				{Name: "branch", Kind: KindString, Description: "Glob matched against the current branch, e.g. release/*", Check: checkGlob},
+				{Name: "path", Kind: KindString, Description: "Glob matched against the worktree directory name, or the full path if it contains /", Check: checkGlob},
+			},
+		},
+		{Name: "vars", Kind: KindMap, Description: "User-defined variables available as ${name}", Elem: &Field{Kind: KindString}},
+		{Name: "env", Kind: KindMap, Description: "Environment variables for hooks, the foreground command and tmux windows", Elem: &Field{Kind: KindString}},
+		{Name: "env_files", Kind: KindList, Description: "Dotenv files loaded before env, relative to the config directory", Elem: stringList},
+		{
+			Name:        "hooks",
+			Kind:        KindObject,
+			Description: "Shell commands run at lifecycle events",
+			Fields: []Field{
+				{Name: "timeout", Kind: KindMap, Description: "Per-hook time limit, keyed by hook name", Elem: &durationField},
+				hookField("on_create", "Run after the project is created"),
+				hookField("on_load", "Run when the project is opened"),
+				hookField("on_close", "Run when the project is closed"),
+				hookField("on_delete", "Run before a worktree is removed"),
+				hookField("on_shell_run_in", "Run before the shell or tmux session starts"),
+				hookField("on_shell_run_out", "Run after the shell exits or the tmux session is created"),
+				hookField("on_error", "Run when wf reports an error; gets WF_MESSAGE and WF_CONTEXT"),
+				hookField("on_warning", "Run when wf reports a warning; gets WF_MESSAGE and WF_CONTEXT"),
+				hookField("on_message", "Run when wf prints a message; gets WF_MESSAGE and WF_CONTEXT"),
+			},
+		},
+		{
+			Name:        "tasks",
+			Kind:        KindMap,
+			Description: "Named command lists runnable with `wf task <name>` or as tmux window \"task:<name>\"",
+			Elem: &Field{
+				Kind:        KindObject,
+				Description: "Task",
+				Fields: []Field{
+					{Name: "description", Kind: KindString, Description: "Shown by `wf task --list`"},
+					{Name: "commands", Kind: KindList, Description: "Shell commands run in order", Elem: stringList},
+					{Name: "depends_on", Kind: KindList, Description: "Tasks run first", Elem: stringList},
+					{Name: "dir", Kind: KindString, Description: "Working directory, relative to the worktree"},
+					{Name: "env", Kind: KindMap, Description: "Extra environment variables", Elem: &Field{Kind: KindString}},
+				},
+			},
+		},
+		{
+			Name:        "tmux",
+			Kind:        KindObject,
+			Description: "tmux session settings",
+			Fields: []Field{
+				{Name: "attach", Kind: KindBool, Description: "Attach to the session after creating it"},
+				{Name: "session_name", Kind: KindString, Description: "Session name; inferred from the path when empty"},
+				{Name: "windows", Kind: KindList, Description: "One command per window", Elem: stringList},
+			},
+		},
+	},
+}
+
+func checkLogLevel(value string) error {
+	if _, ok := log.ParseLogLevel(value); !ok {
+		return fmt.Errorf("invalid log level %q (expected one of %s)", value, strings.Join(log.LevelNames, ", "))
+	}
+	return nil
+}
+
+func checkDuration(value string) error {
+	if _, err := time.ParseDuration(value); err != nil {
+		return fmt.Errorf("invalid duration %q (e.g. 30s, 5m)", value)
+	}
+	return nil
+}
+
+func checkGlob(value string) error {
+	if _, err := path.Match(value, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %w", value, err)
+	}
+	return nil
+}
+
+// PluginSection is a top-level profile key owned by an installed plugin.
+type PluginSection struct {
+	Key    string
+	Plugin string
+	Schema json.RawMessage
+}
+
+// JSONSchema renders TemplateSchema, plus any plugin sections, as a JSON
+// Schema document for editor autocompletion.
+func (s *ConfigService) JSONSchema(plugins []PluginSection) ([]byte, error) {
+	profile := jsonSchemaFor(TemplateSchema)
+	props := profile["properties"].(map[string]any)
+	for _, p := range plugins {
+		section := map[string]any{
+			"type":        "object",
+			"description": fmt.Sprintf("Configuration for plugin %s", p.Plugin),
+		}
+		if len(p.Schema) > 0 {
+			var custom map[string]any
+			if err := json.Unmarshal(p.Schema, &custom); err != nil {
+				return nil, fmt.Errorf("plugin %s: invalid config schema: %w", p.Plugin, err)
+			}
+			section = custom
+			if _, ok := section["description"]; !ok {
+				section["description"] = fmt.Sprintf("Configuration for plugin %s", p.Plugin)
+			}
+		}
+		props[p.Key] = section
+	}
+
+	doc := map[string]any{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                "Workforge configuration (" + ConfigFileName + ")",
+		"type":                 "object",
+		"additionalProperties": profile,
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func jsonSchemaFor(f Field) map[string]any {
+	out := map[string]any{}
+	if f.Description != "" {
+		out["description"] = f.Description
+	}
+	switch f.Kind {
+	case KindList:
+		out["type"] = "array"
+		if f.Elem != nil {
+			out["items"] = jsonSchemaFor(*f.Elem)
+		}
+	case KindMap:
+		out["type"] = "object"
+		if f.Elem != nil {
+			out["additionalProperties"] = jsonSchemaFor(*f.Elem)
+		}
+	case KindObject:
+		out["type"] = "object"
+		props := map[string]any{}
+		var required []string
+		for _, sub := range f.Fields {
+			props[sub.Name] = jsonSchemaFor(sub)
+			if sub.Required {
+				required = append(required, sub.Name)
+			}
+		}
+		out["properties"] = props
+		if len(required) > 0 {
+			out["required"] = required
+		}
+		out["additionalProperties"] = false
+	case KindUnion:
+		variants := make([]any, len(f.Variants))
+		for i, v := range f.Variants {
+			variants[i] = jsonSchemaFor(v)
+		}
+		out["oneOf"] = variants
+	default:
+		out["type"] = string(f.Kind)
+	}
+	if len(f.Enum) > 0 {
+		enum := make([]string, 0, len(f.Enum)*2)
+		for _, v := range f.Enum {
+			enum = append(enum, v, strings.ToLower(v))
+		}
+		out["enum"] = enum
+	}
+	return out
+}
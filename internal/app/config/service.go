@@ -1,7 +1,6 @@
 package config
 
 import (
-	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -63,27 +62,6 @@ func (s *ConfigService) WriteConfig(path string, cfg Config) error {
 	return enc.Close()
 }
 
-func (s *ConfigService) SelectProfile(cfg Config, requested *string) (string, error) {
-	if requested != nil && *requested != "" {
-		if _, ok := cfg[*requested]; !ok {
-			return "", fmt.Errorf("profile %q not found", *requested)
-		}
-		return *requested, nil
-	}
-	if len(cfg) == 0 {
-		return "", fmt.Errorf("no profiles defined in config")
-	}
-	if len(cfg) == 1 {
-		for k := range cfg {
-			return k, nil
-		}
-	}
-	if _, ok := cfg[DefaultProfile]; ok {
-		return DefaultProfile, nil
-	}
-	return "", fmt.Errorf("multiple profiles defined; specify --profile")
-}
-
 func (s *ConfigService) SetLogLevel(level string) {
 	log.SetLogLevelFromString(level)
 }
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const TaskWindowPrefix = "task:"
+
+// TaskOrder returns name and its dependencies in execution order, each task
+// appearing once.
+func TaskOrder(tasks map[string]Task, name string) ([]string, error) {
+	var order []string
+	state := make(map[string]int) // 1 = visiting, 2 = done
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("task dependency cycle: %s", strings.Join(append(chain, name), " -> "))
+		case 2:
+			return nil
+		}
+		task, ok := tasks[name]
+		if !ok {
+			if len(chain) == 0 {
+				return fmt.Errorf("task %q not found", name)
+			}
+			return fmt.Errorf("task %q depends on unknown task %q", chain[len(chain)-1], name)
+		}
+		state[name] = 1
+		for _, dep := range task.DependsOn {
+			if err := visit(dep, append(chain, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+	if err := visit(name, nil); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func TaskNames(tasks map[string]Task) []string {
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"workforge/internal/util"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Issue is a single validation finding located in the YAML source.
+type Issue struct {
+	Severity Severity
+	Line     int
+	Column   int
+	Path     string
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%d:%d: %s: %s", i.Line, i.Column, i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s: %s", i.Line, i.Column, i.Severity, i.Path, i.Message)
+}
+
+func HasErrors(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// FindConfigPath returns the config file governing dir: dir itself, or its
+// parent when dir is a worktree leaf.
+func (s *ConfigService) FindConfigPath(dir string) (string, error) {
+	for _, candidate := range []string{s.ResolveConfigPath(dir, false), s.ResolveConfigPath(dir, true)} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no %s found in %s or its parent", ConfigFileName, dir)
+}
+
+func (s *ConfigService) ValidateFile(path string, plugins []PluginSection) ([]Issue, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(data, plugins), nil
+}
+
+// Validate checks raw .wfconfig.yml content against TemplateSchema. Unknown
+// profile keys are accepted when they belong to a registered plugin.
+func (s *ConfigService) Validate(data []byte, plugins []PluginSection) []Issue {
+	v := &validator{pluginKeys: make(map[string]string)}
+	for _, p := range plugins {
+		v.pluginKeys[p.Key] = p.Plugin
+	}
+
+	var doc yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&doc); err != nil {
+		line := 0
+		msg := err.Error()
+		fmt.Sscanf(msg, "yaml: line %d:", &line)
+		return []Issue{{Severity: SeverityError, Line: line, Message: msg}}
+	}
+	if len(doc.Content) == 0 {
+		return []Issue{{Severity: SeverityError, Line: 1, Column: 1, Message: "config is empty"}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		v.add(SeverityError, root, "", "expected a mapping of profile names")
+		return v.issues
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name := root.Content[i].Value
+		v.checkProfile(name, root.Content[i+1])
+	}
+
+	sort.SliceStable(v.issues, func(a, b int) bool {
+		if v.issues[a].Line != v.issues[b].Line {
+			return v.issues[a].Line < v.issues[b].Line
+		}
+		return v.issues[a].Column < v.issues[b].Column
+	})
+	return v.issues
+}
+
+type validator struct {
+	pluginKeys map[string]string
+	issues     []Issue
+}
+
+func (v *validator) add(sev Severity, n *yaml.Node, path string, msg string, args ...any) {
+	v.issues = append(v.issues, Issue{
+		Severity: sev,
+		Line:     n.Line,
+		Column:   n.Column,
+		Path:     path,
+		Message:  fmt.Sprintf(msg, args...),
+	})
+}
+
+func (v *validator) checkProfile(name string, n *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		v.add(SeverityError, n, name, "profile must be a mapping, got %s", nodeKind(n))
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		path := name + "." + key.Value
+		if f, ok := TemplateSchema.lookup(key.Value); ok {
+			v.check(f, val, path)
+			continue
+		}
+		if plugin, ok := v.pluginKeys[key.Value]; ok {
+			v.add(SeverityInfo, key, path, "configuration for plugin %s", plugin)
+			continue
+		}
+		hooks, _ := TemplateSchema.lookup("hooks")
+		if hookName := util.Closest(key.Value, hooks.fieldNames()); hookName != "" {
+			v.add(SeverityError, key, name, "unknown key %q (did you mean hooks.%s?)", key.Value, hookName)
+			continue
+		}
+		v.unknownKey(key, name, TemplateSchema.fieldNames())
+	}
+}
+
+func (v *validator) check(f Field, n *yaml.Node, path string) {
+	if n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	switch f.Kind {
+	case KindUnion:
+		for _, variant := range f.Variants {
+			if variant.accepts(n) {
+				v.check(variant, n, path)
+				return
+			}
+		}
+		v.add(SeverityError, n, path, "unexpected %s", nodeKind(n))
+	case KindString:
+		if !isScalar(n, "!!str", "!!int", "!!float", "!!bool", "!!null") {
+			v.add(SeverityError, n, path, "expected string, got %s", nodeKind(n))
+			return
+		}
+		if f.Check != nil {
+			if err := f.Check(n.Value); err != nil {
+				v.add(SeverityError, n, path, "%v", err)
+			}
+		}
+	case KindBool:
+		if !isScalar(n, "!!bool") {
+			v.add(SeverityError, n, path, "expected boolean, got %s", nodeKind(n))
+		}
+	case KindList:
+		if n.Kind != yaml.SequenceNode {
+			v.add(SeverityError, n, path, "expected list, got %s", nodeKind(n))
+			return
+		}
+		for i, item := range n.Content {
+			v.check(*f.Elem, item, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case KindMap:
+		if n.Kind != yaml.MappingNode {
+			v.add(SeverityError, n, path, "expected mapping, got %s", nodeKind(n))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.check(*f.Elem, n.Content[i+1], path+"."+n.Content[i].Value)
+		}
+	case KindObject:
+		if n.Kind != yaml.MappingNode {
+			v.add(SeverityError, n, path, "expected mapping, got %s", nodeKind(n))
+			return
+		}
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			sub, ok := f.lookup(key.Value)
+			if !ok {
+				v.unknownKey(key, path, f.fieldNames())
+				continue
+			}
+			seen[key.Value] = true
+			v.check(sub, val, path+"."+key.Value)
+		}
+		for _, sub := range f.Fields {
+			if sub.Required && !seen[sub.Name] {
+				v.add(SeverityError, n, path, "missing required key %q", sub.Name)
+			}
+		}
+	}
+}
+
+// accepts reports whether n has the YAML shape of f, ignoring contents.
+func (f Field) accepts(n *yaml.Node) bool {
+	switch f.Kind {
+	case KindString, KindBool:
+		return n.Kind == yaml.ScalarNode
+	case KindList:
+		return n.Kind == yaml.SequenceNode
+	case KindMap, KindObject:
+		return n.Kind == yaml.MappingNode
+	}
+	return false
+}
+
+func (v *validator) unknownKey(key *yaml.Node, path string, known []string) {
+	candidates := append([]string{}, known...)
+	for k := range v.pluginKeys {
+		candidates = append(candidates, k)
+	}
+	if suggestion := util.Closest(key.Value, candidates); suggestion != "" {
+		v.add(SeverityError, key, path, "unknown key %q (did you mean %q?)", key.Value, suggestion)
+		return
+	}
+	v.add(SeverityError, key, path, "unknown key %q", key.Value)
+}
+
+func isScalar(n *yaml.Node, tags ...string) bool {
+	if n.Kind != yaml.ScalarNode {
+		return false
+	}
+	for _, t := range tags {
+		if n.ShortTag() == t {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeKind(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.ScalarNode:
+		return strings.TrimPrefix(n.ShortTag(), "!!")
+	default:
+		return "unknown"
+	}
+}
@@ -1,5 +1,7 @@
 package hook
 
+import "time"
+
 // HookType identifies the type of hook event
 type HookType string
 
@@ -17,8 +19,39 @@ const (
 	HookOnMessage          HookType = "on_message"
 	HookOnTmuxSessionStart HookType = "on_tmux_session_start"
 	HookOnTmuxWindow       HookType = "on_tmux_window"
+	HookOnTaskStart        HookType = "on_task_start"
+	HookOnTaskEnd          HookType = "on_task_end"
+	HookOnHealthcheck      HookType = "on_healthcheck"
+
+	// Pre-hooks run before an operation; plugins may abort it or, for
+	// pre_open, add env variables and tmux windows. See PluginResponse.
+	HookPreOpen   HookType = "pre_open"
+	HookPreDelete HookType = "pre_delete"
 )
 
+// IsPreHook reports whether plugins may veto the operation behind t.
+func (t HookType) IsPreHook() bool {
+	return t == HookPreOpen || t == HookPreDelete
+}
+
+// HookTypes lists every hook a plugin may subscribe to.
+var HookTypes = []HookType{
+	HookOnLoad, HookOnClose, HookOnCreate, HookOnDelete,
+	HookOnShellRunIn, HookOnShellRunOut, HookOnPluginWakeup,
+	HookOnError, HookOnWarning, HookOnDebug, HookOnMessage,
+	HookOnTmuxSessionStart, HookOnTmuxWindow, HookOnTaskStart, HookOnTaskEnd,
+	HookOnHealthcheck, HookPreOpen, HookPreDelete,
+}
+
+// HookNames returns the names of HookTypes.
+func HookNames() []string {
+	names := make([]string, len(HookTypes))
+	for i, t := range HookTypes {
+		names[i] = string(t)
+	}
+	return names
+}
+
 const (
 	FieldError   = "error"
 	FieldWarning = "warning"
@@ -28,6 +61,10 @@ const (
 	FieldSession = "session"
 	FieldWindow  = "window"
 	FieldCommand = "command"
+	FieldTask    = "task"
+	FieldPath    = "path"
+	FieldBranch  = "branch"
+	FieldProfile = "profile"
 )
 
 type HookPayload struct {
@@ -92,6 +129,11 @@ func (p *HookPayload) WithCommand(cmd string) *HookPayload {
 	return p
 }
 
+func (p *HookPayload) WithTask(name string) *HookPayload {
+	p.Data[FieldTask] = name
+	return p
+}
+
 func (p *HookPayload) WithField(key string, value any) *HookPayload {
 	p.Data[key] = value
 	return p
@@ -105,5 +147,7 @@ func (p *HookPayload) WithConfig(cfg map[string]any) *HookPayload {
 type HookResult struct {
 	PluginName string
 	Response   string
+	Reply      *PluginResponse
 	Error      error
+	Duration   time.Duration
 }
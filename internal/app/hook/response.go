@@ -0,0 +1,103 @@
+package hook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	ActionContinue = "continue"
+	ActionAbort    = "abort"
+)
+
+// PluginResponse is the result a plugin may return from a hook. Every field
+// is optional; a plain JSON string is taken as Message. Action, Env and
+// Windows are honored for pre-hooks only.
+type PluginResponse struct {
+	Action  string            `json:"action,omitempty"`
+	Reason  string            `json:"reason,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Windows []string          `json:"windows,omitempty"`
+}
+
+// ParseResponse decodes a hook result. null and empty results give nil.
+func ParseResponse(raw json.RawMessage) (*PluginResponse, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	switch trimmed[0] {
+	case '{':
+		var resp PluginResponse
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return nil, fmt.Errorf("invalid hook response: %w", err)
+		}
+		switch resp.Action {
+		case "", ActionContinue, ActionAbort:
+		default:
+			return nil, fmt.Errorf("invalid hook response: unknown action %q", resp.Action)
+		}
+		return &resp, nil
+	case '"':
+		var msg string
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return nil, fmt.Errorf("invalid hook response: %w", err)
+		}
+		return &PluginResponse{Message: msg}, nil
+	}
+	return &PluginResponse{Message: trimmed}, nil
+}
+
+// AbortError is returned when a plugin vetoes an operation from a pre-hook.
+type AbortError struct {
+	Hook   HookType
+	Plugin string
+	Reason string
+}
+
+func (e AbortError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("aborted by plugin %s (%s)", e.Plugin, e.Hook)
+	}
+	return fmt.Sprintf("aborted by plugin %s (%s): %s", e.Plugin, e.Hook, e.Reason)
+}
+
+// vetoes reports whether r stops a pre-hook: an abort or a failure.
+func (r HookResult) vetoes() bool {
+	return r.Error != nil || (r.Reply != nil && r.Reply.Action == ActionAbort)
+}
+
+// Outcome merges what the plugins answered to a pre-hook.
+type Outcome struct {
+	Env     map[string]string
+	Windows []string
+}
+
+// Merge combines pre-hook results in plugin order: later env values win and
+// windows are appended. The first abort wins and is returned as AbortError.
+// Pre-hooks fail closed: a plugin that failed or timed out blocks the
+// operation like an abort.
+func Merge(hookType HookType, results []HookResult) (Outcome, error) {
+	var out Outcome
+	for _, r := range results {
+		if r.Error != nil {
+			return Outcome{}, fmt.Errorf("%s: plugin %s failed, blocking the operation: %w", hookType, r.PluginName, r.Error)
+		}
+		if r.Reply == nil {
+			continue
+		}
+		if r.Reply.Action == ActionAbort {
+			return Outcome{}, AbortError{Hook: hookType, Plugin: r.PluginName, Reason: r.Reply.Reason}
+		}
+		for k, v := range r.Reply.Env {
+			if out.Env == nil {
+				out.Env = make(map[string]string)
+			}
+			out.Env[k] = v
+		}
+		out.Windows = append(out.Windows, r.Reply.Windows...)
+	}
+	return out, nil
+}
@@ -2,7 +2,11 @@ package hook
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"workforge/internal/app/plugin"
 )
@@ -10,6 +14,7 @@ import (
 type HookService struct {
 	pluginSvc      *plugin.PluginService
 	pluginRegistry *plugin.PluginRegistryService
+	async          sync.WaitGroup
 }
 
 func NewHookService(pluginSvc *plugin.PluginService, pluginRegistry *plugin.PluginRegistryService) *HookService {
@@ -19,6 +24,19 @@ func NewHookService(pluginSvc *plugin.PluginService, pluginRegistry *plugin.Plug
 	}
 }
 
+// maxConcurrentPlugins bounds the plugins called at once within a
+// priority group.
+const maxConcurrentPlugins = 4
+
+// asyncWaitTimeout is how long Wait gives async plugin calls at exit.
+const asyncWaitTimeout = 2 * time.Second
+
+// Run delivers payload to every plugin subscribed to its hook. Plugins are
+// called in priority groups, highest first; the plugins of a group run
+// concurrently and their output is printed in registry order once the
+// group is done. Async plugins get a notification instead of a call and
+// are not part of the results. A pre-hook stops after the first group in
+// which a plugin aborted or failed.
 func (s *HookService) Run(payload *HookPayload) []HookResult {
 	return s.runPluginHooks(payload)
 }
@@ -30,44 +48,159 @@ func (s *HookService) runPluginHooks(payload *HookPayload) []HookResult {
 	}
 
 	var results []HookResult
-	hookName := string(payload.Type)
+	for _, group := range priorityGroups(plugins, string(payload.Type)) {
+		var waited []plugin.PluginEntry
+		for _, p := range group {
+			if p.Mode == plugin.ModeAsync {
+				s.callAsync(p, payload)
+				continue
+			}
+			waited = append(waited, p)
+		}
 
-	for _, p := range plugins {
-		if !hasHook(p.Hooks, hookName) {
-			continue
+		groupResults := make([]HookResult, len(waited))
+		sem := make(chan struct{}, maxConcurrentPlugins)
+		var wg sync.WaitGroup
+		for i, p := range waited {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, p plugin.PluginEntry) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				groupResults[i] = s.callPlugin(p, payload)
+			}(i, p)
 		}
+		wg.Wait()
 
-		if err := s.pluginSvc.Wakeup(p.Name); err != nil {
-			results = append(results, HookResult{
-				PluginName: p.Name,
-				Error:      err,
-			})
-			continue
+		for _, r := range groupResults {
+			if r.Response != "" {
+				fmt.Println(r.Response)
+			}
+		}
+		results = append(results, groupResults...)
+		if payload.Type.IsPreHook() && slices.ContainsFunc(groupResults, HookResult.vetoes) {
+			break
 		}
+	}
 
-		wirePayload := s.buildWirePayload(payload, p.ConfigKey)
+	return results
+}
 
-		resp, err := s.pluginSvc.Call(p.Name, hookName, wirePayload)
-		if err != nil {
-			results = append(results, HookResult{
-				PluginName: p.Name,
-				Error:      err,
-			})
-			continue
+// priorityGroups returns the plugins subscribed to hookName grouped by
+// priority, highest first, keeping registry order within a group.
+func priorityGroups(plugins []plugin.PluginEntry, hookName string) [][]plugin.PluginEntry {
+	var subscribed []plugin.PluginEntry
+	for _, p := range plugins {
+		if hasHook(p.Hooks, hookName) {
+			subscribed = append(subscribed, p)
 		}
+	}
+	sort.SliceStable(subscribed, func(i, j int) bool {
+		return subscribed[i].Priority > subscribed[j].Priority
+	})
+
+	var groups [][]plugin.PluginEntry
+	for i, p := range subscribed {
+		if i == 0 || p.Priority != subscribed[i-1].Priority {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], p)
+	}
+	return groups
+}
+
+// Call delivers payload to plugin p and waits for its reply, whatever
+// mode the plugin runs in. Nothing is printed.
+func (s *HookService) Call(p plugin.PluginEntry, payload *HookPayload) HookResult {
+	return s.callPlugin(p, payload)
+}
+
+func (s *HookService) callPlugin(p plugin.PluginEntry, payload *HookPayload) (result HookResult) {
+	start := time.Now()
+	result.PluginName = p.Name
+	defer func() { result.Duration = time.Since(start) }()
+
+	if err := s.pluginSvc.Wakeup(p.Name); err != nil {
+		result.Error = err
+		return result
+	}
 
-		response := cleanResponse(resp)
-		if response != "" {
-			fmt.Println(response)
+	wirePayload := s.buildWirePayload(payload, p.ConfigKey)
+	resp, err := s.pluginSvc.Call(p.Name, string(payload.Type), wirePayload)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	reply, err := ParseResponse(resp)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	result.Reply = reply
+	if reply != nil {
+		result.Response = reply.Message
+	}
+	return result
+}
+
+// callAsync notifies an async plugin without waiting for it to wake up.
+func (s *HookService) callAsync(p plugin.PluginEntry, payload *HookPayload) {
+	s.async.Add(1)
+	go func() {
+		defer s.async.Done()
+		s.notifyPlugin(p, []*HookPayload{payload})
+	}()
+}
+
+// Notify delivers payloads to their subscribed plugins as JSON-RPC
+// notifications, batched per plugin, without waiting for replies. It is
+// used for event hooks whose answer nobody reads, such as on_debug.
+func (s *HookService) Notify(payloads ...*HookPayload) {
+	plugins, err := s.pluginRegistry.List()
+	if err != nil {
+		return
+	}
+	for _, p := range plugins {
+		var subscribed []*HookPayload
+		for _, payload := range payloads {
+			if hasHook(p.Hooks, string(payload.Type)) {
+				subscribed = append(subscribed, payload)
+			}
 		}
+		if len(subscribed) > 0 {
+			s.notifyPlugin(p, subscribed)
+		}
+	}
+}
 
-		results = append(results, HookResult{
-			PluginName: p.Name,
-			Response:   response,
-		})
+func (s *HookService) notifyPlugin(p plugin.PluginEntry, payloads []*HookPayload) {
+	if err := s.pluginSvc.Wakeup(p.Name); err != nil {
+		return
+	}
+	notes := make([]plugin.Notification, len(payloads))
+	for i, payload := range payloads {
+		notes[i] = plugin.Notification{
+			JSONRPC: "2.0",
+			Method:  string(payload.Type),
+			Params:  s.buildWirePayload(payload, p.ConfigKey),
+		}
 	}
+	s.pluginSvc.Notify(p.Name, notes...)
+}
 
-	return results
+// Wait gives async plugin notifications still in flight a moment to be
+// sent before wf exits.
+func (s *HookService) Wait() {
+	done := make(chan struct{})
+	go func() {
+		s.async.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(asyncWaitTimeout):
+	}
 }
 
 func (s *HookService) buildWirePayload(payload *HookPayload, configKey string) map[string]any {
@@ -89,8 +222,15 @@ func (s *HookService) buildWirePayload(payload *HookPayload, configKey string) m
 	return wire
 }
 
-func (s *HookService) KillAllPlugins() {
-	s.pluginSvc.KillAll()
+// ReleasePlugins stops the plugins that end with this wf command and those
+// idle past their timeout, leaving daemons running.
+func (s *HookService) ReleasePlugins() {
+	s.pluginSvc.Release()
+}
+
+// StopHost closes the host endpoints this process serves to plugins.
+func (s *HookService) StopHost() {
+	s.pluginSvc.StopHost()
 }
 
 func hasHook(hooks []string, target string) bool {
@@ -101,11 +241,3 @@ func hasHook(hooks []string, target string) bool {
 	}
 	return false
 }
-
-func cleanResponse(resp []byte) string {
-	s := strings.TrimSpace(string(resp))
-	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-		s = s[1 : len(s)-1]
-	}
-	return s
-}
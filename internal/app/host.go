@@ -0,0 +1,184 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"workforge/internal/app/config"
+	"workforge/internal/app/plugin"
+	infragit "workforge/internal/infra/git"
+	"workforge/internal/infra/tmux"
+)
+
+// Host methods plugins may call back into, each gated by the plugin's
+// declared capabilities.
+const (
+	HostProjectsList  = "projects.list"
+	HostConfigResolve = "config.resolve"
+	HostGitStatus     = "git.status"
+	HostLogWrite      = "log.write"
+	HostTmuxSendKeys  = "tmux.sendKeys"
+)
+
+// HostMethodNames lists the methods served to plugins.
+var HostMethodNames = []string{HostProjectsList, HostConfigResolve, HostGitStatus, HostLogWrite, HostTmuxSendKeys}
+
+// HostMethods returns the handlers of HostMethodNames.
+func (o *Orchestrator) HostMethods() map[string]plugin.HostMethod {
+	return map[string]plugin.HostMethod{
+		HostProjectsList:  o.hostProjectsList,
+		HostConfigResolve: o.hostConfigResolve,
+		HostGitStatus:     o.hostGitStatus,
+		HostLogWrite:      o.hostLogWrite,
+		HostTmuxSendKeys:  o.hostTmuxSendKeys,
+	}
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+type hostProject struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	GWT  bool   `json:"gwt"`
+}
+
+func (o *Orchestrator) hostProjectsList(caller string, params json.RawMessage) (interface{}, error) {
+	entries, err := o.projects.SortedProjectEntries()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]hostProject, len(entries))
+	for i, e := range entries {
+		out[i] = hostProject{Name: e.Name, Path: e.Path, GWT: e.IsGWT}
+	}
+	return out, nil
+}
+
+// hostConfigResolve returns the expanded profile of a registered project
+// and its environment, as `wf open` would use them.
+func (o *Orchestrator) hostConfigResolve(caller string, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Project string `json:"project"`
+		Profile string `json:"profile"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Project == "" {
+		return nil, fmt.Errorf("project is required")
+	}
+	entry, err := o.projects.FindProjectEntry(p.Project)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := o.config.LoadConfig(entry.Path, entry.IsGWT)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+	var requested *string
+	if p.Profile != "" {
+		requested = &p.Profile
+	}
+	selection, err := o.selectProfile(cfg, requested, entry.Path)
+	if err != nil {
+		return nil, err
+	}
+	tpl, session, err := o.expand(cfg, selection.Name, entry.Path, entry.IsGWT, entry.Name)
+	if err != nil {
+		return nil, err
+	}
+	values, err := config.TemplateValues(tpl)
+	if err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(session.Env))
+	for _, kv := range session.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+	return map[string]interface{}{
+		"project": entry.Name,
+		"profile": selection.Name,
+		"config":  values,
+		"env":     env,
+	}, nil
+}
+
+func (o *Orchestrator) hostGitStatus(caller string, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Path    string `json:"path"`
+		Project string `json:"project"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	path := p.Path
+	if p.Project != "" {
+		entry, err := o.projects.FindProjectEntry(p.Project)
+		if err != nil {
+			return nil, err
+		}
+		path = entry.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("path or project is required")
+	}
+	lines, err := infragit.GitStatus(path)
+	if err != nil {
+		return nil, err
+	}
+	branch := ""
+	changes := []string{}
+	for _, line := range lines {
+		if header, ok := strings.CutPrefix(line, "## "); ok {
+			branch, _, _ = strings.Cut(header, "...")
+			continue
+		}
+		changes = append(changes, line)
+	}
+	return map[string]interface{}{
+		"path":    path,
+		"branch":  branch,
+		"clean":   len(changes) == 0,
+		"changes": changes,
+	}, nil
+}
+
+func (o *Orchestrator) hostLogWrite(caller string, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	o.log.Plugin(caller, p.Level, p.Message)
+	return true, nil
+}
+
+func (o *Orchestrator) hostTmuxSendKeys(caller string, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Target string `json:"target"`
+		Keys   string `json:"keys"`
+		Enter  bool   `json:"enter"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Target == "" {
+		return nil, fmt.Errorf("target is required")
+	}
+	if err := tmux.SendKeys(p.Target, p.Keys, p.Enter); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
@@ -0,0 +1,131 @@
+package log
+
+import (
+	"sync"
+	"time"
+
+	"workforge/internal/app/hook"
+)
+
+const (
+	// hookQueueSize bounds the log-derived hooks waiting for delivery.
+	hookQueueSize = 256
+	// flushTimeout is how long Close waits for queued hooks.
+	flushTimeout = 2 * time.Second
+	// maxBatch bounds the notifications sent to a plugin at once.
+	maxBatch = 32
+)
+
+// dispatcher delivers log-derived plugin hooks. on_debug and on_message go
+// through a bounded queue drained by one goroutine and are sent as batched
+// notifications, so logging never waits for a plugin; when the queue is
+// full they are dropped and counted.
+// on_error and on_warning are delivered inline, one at a time; one logged
+// while another is delivered, e.g. by a parallel hook command, waits for
+// it. Delivery never logs, so it cannot
+// re-enter the dispatcher.
+type dispatcher struct {
+	hooks HookRunner
+
+	inline sync.Mutex
+
+	mu      sync.Mutex
+	queue   chan *hook.HookPayload
+	closed  bool
+	done    chan struct{}
+	dropped map[hook.HookType]int
+}
+
+func newDispatcher(hooks HookRunner) *dispatcher {
+	return &dispatcher{hooks: hooks, dropped: make(map[hook.HookType]int)}
+}
+
+func (d *dispatcher) sync(payload *hook.HookPayload) {
+	d.inline.Lock()
+	defer d.inline.Unlock()
+	d.hooks.Run(payload)
+}
+
+func (d *dispatcher) async(payload *hook.HookPayload) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		d.dropped[payload.Type]++
+		return
+	}
+	if d.queue == nil {
+		d.queue = make(chan *hook.HookPayload, hookQueueSize)
+		d.done = make(chan struct{})
+		go d.drain(d.queue, d.done)
+	}
+	select {
+	case d.queue <- payload:
+	default:
+		d.dropped[payload.Type]++
+	}
+}
+
+// drain sends queued hooks as notifications, batching whatever has piled
+// up since the last send.
+func (d *dispatcher) drain(queue <-chan *hook.HookPayload, done chan<- struct{}) {
+	defer close(done)
+	for payload := range queue {
+		batch := []*hook.HookPayload{payload}
+	collect:
+		for len(batch) < maxBatch {
+			select {
+			case next, ok := <-queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+		d.hooks.Notify(batch...)
+	}
+}
+
+// close stops accepting hooks and waits up to flushTimeout for the queued
+// ones. It returns the number dropped per hook type.
+func (d *dispatcher) close() map[hook.HookType]int {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	queue, done := d.queue, d.done
+	d.mu.Unlock()
+
+	if queue != nil {
+		close(queue)
+		select {
+		case <-done:
+		case <-time.After(flushTimeout):
+			d.discard(queue)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.dropped
+}
+
+// discard counts what is still queued after the flush timeout as dropped.
+func (d *dispatcher) discard(queue <-chan *hook.HookPayload) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for {
+		select {
+		case payload, ok := <-queue:
+			if !ok {
+				return
+			}
+			d.dropped[payload.Type]++
+		default:
+			return
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"workforge/internal/app/hook"
 )
@@ -29,36 +30,73 @@ const (
 
 type HookRunner interface {
 	Run(payload *hook.HookPayload) []hook.HookResult
+	Notify(payloads ...*hook.HookPayload)
+}
+
+// ShellHooks runs the shell commands a profile configures for on_error,
+// on_warning and on_message.
+type ShellHooks interface {
+	RunLogHook(hookType hook.HookType, message, source string)
 }
 
 type LogService struct {
-	hooks   HookRunner
-	project string
+	hooks    HookRunner
+	dispatch *dispatcher
+	shell    ShellHooks
+	project  string
+
+	// shellMu runs shell log hooks one at a time.
+	shellMu sync.Mutex
 }
 
 func NewLogService(hooks HookRunner) *LogService {
-	return &LogService{
+	s := &LogService{
 		hooks:   hooks,
 		project: projectNameFromCwd(),
 	}
+	if hooks != nil {
+		s.dispatch = newDispatcher(hooks)
+	}
+	return s
 }
 
 func (s *LogService) SetProject(name string) {
 	s.project = strings.TrimSpace(name)
 }
 
+func (s *LogService) SetShellHooks(h ShellHooks) {
+	s.shell = h
+}
+
+// WithoutShellHooks returns a LogService that logs and notifies plugins
+// like s but never runs shell log hooks. The shell hooks log through it,
+// so what they log cannot trigger them again.
+func (s *LogService) WithoutShellHooks() *LogService {
+	return &LogService{hooks: s.hooks, dispatch: s.dispatch, project: s.project}
+}
+
+func (s *LogService) runShellHook(hookType hook.HookType, message, context string) {
+	if s.shell == nil {
+		return
+	}
+	s.shellMu.Lock()
+	defer s.shellMu.Unlock()
+	s.shell.RunLogHook(hookType, message, context)
+}
+
 func (s *LogService) Error(context string, err error) error {
 	if err == nil {
 		return nil
 	}
 	s.out(os.Stderr, colRed, iconError, "ERROR", "%v", err)
 
-	if s.hooks != nil {
+	if s.dispatch != nil {
 		payload := hook.NewPayload(s.project, hook.HookOnError).
 			WithError(err).
 			WithContext(context)
-		s.hooks.Run(payload)
+		s.dispatch.sync(payload)
 	}
+	s.runShellHook(hook.HookOnError, err.Error(), context)
 	return err
 }
 
@@ -66,12 +104,13 @@ func (s *LogService) ErrorMsg(context string, msg string, args ...any) {
 	formatted := fmt.Sprintf(msg, args...)
 	s.out(os.Stderr, colRed, iconError, "ERROR", "%s", formatted)
 
-	if s.hooks != nil {
+	if s.dispatch != nil {
 		payload := hook.NewPayload(s.project, hook.HookOnError).
 			WithErrorMsg(formatted).
 			WithContext(context)
-		s.hooks.Run(payload)
+		s.dispatch.sync(payload)
 	}
+	s.runShellHook(hook.HookOnError, formatted, context)
 }
 
 func (s *LogService) Warn(context string, msg string, args ...any) {
@@ -80,36 +119,39 @@ func (s *LogService) Warn(context string, msg string, args ...any) {
 		s.out(os.Stderr, colYellow, iconWarn, "WARN", "%s", formatted)
 	}
 
-	if s.hooks != nil {
+	if s.dispatch != nil {
 		payload := hook.NewPayload(s.project, hook.HookOnWarning).
 			WithWarning(formatted).
 			WithContext(context)
-		s.hooks.Run(payload)
+		s.dispatch.sync(payload)
 	}
+	s.runShellHook(hook.HookOnWarning, formatted, context)
 }
 
 func (s *LogService) Info(context string, msg string, args ...any) {
 	formatted := fmt.Sprintf(msg, args...)
 	s.out(os.Stdout, colBlue, iconInfo, "INFO", "%s", formatted)
 
-	if s.hooks != nil {
+	if s.dispatch != nil {
 		payload := hook.NewPayload(s.project, hook.HookOnMessage).
 			WithMessage(formatted).
 			WithSource(context)
-		s.hooks.Run(payload)
+		s.dispatch.async(payload)
 	}
+	s.runShellHook(hook.HookOnMessage, formatted, context)
 }
 
 func (s *LogService) Success(context string, msg string, args ...any) {
 	formatted := fmt.Sprintf(msg, args...)
 	s.out(os.Stdout, colGreen, iconSuccess, "OK", "%s", formatted)
 
-	if s.hooks != nil {
+	if s.dispatch != nil {
 		payload := hook.NewPayload(s.project, hook.HookOnMessage).
 			WithMessage(formatted).
 			WithSource(context)
-		s.hooks.Run(payload)
+		s.dispatch.async(payload)
 	}
+	s.runShellHook(hook.HookOnMessage, formatted, context)
 }
 
 func (s *LogService) Debug(context string, msg string, args ...any) {
@@ -118,11 +160,50 @@ func (s *LogService) Debug(context string, msg string, args ...any) {
 		s.out(os.Stdout, colMagenta, iconDebug, "DEBUG", "%s", formatted)
 	}
 
-	if s.hooks != nil {
+	if s.dispatch != nil {
 		payload := hook.NewPayload(s.project, hook.HookOnDebug).
 			WithMessage(formatted).
 			WithContext(context)
-		s.hooks.Run(payload)
+		s.dispatch.async(payload)
+	}
+}
+
+// Plugin prints a message written by a plugin through the host endpoint.
+// It does not dispatch hooks, so a plugin that logs from its on_message
+// handler cannot loop.
+func (s *LogService) Plugin(name string, level string, message string) {
+	message = fmt.Sprintf("[%s] %s", name, message)
+	switch strings.ToLower(level) {
+	case "error":
+		s.out(os.Stderr, colRed, iconError, "ERROR", "%s", message)
+	case "warn", "warning":
+		if Verbose() {
+			s.out(os.Stderr, colYellow, iconWarn, "WARN", "%s", message)
+		}
+	case "debug":
+		if Verbose() {
+			s.out(os.Stdout, colMagenta, iconDebug, "DEBUG", "%s", message)
+		}
+	default:
+		s.out(os.Stdout, colBlue, iconInfo, "INFO", "%s", message)
+	}
+}
+
+// Close delivers the queued on_debug and on_message hooks, waiting a short
+// while, and reports how many were dropped. Log calls made afterwards no
+// longer reach plugins.
+func (s *LogService) Close() {
+	if s.dispatch == nil {
+		return
+	}
+	dropped := s.dispatch.close()
+	if !Verbose() {
+		return
+	}
+	for hookType, n := range dropped {
+		if n > 0 {
+			s.out(os.Stderr, colYellow, iconWarn, "WARN", "dropped %d %s plugin hooks", n, hookType)
+		}
 	}
 }
 
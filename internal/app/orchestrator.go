@@ -1,10 +1,13 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"workforge/internal/app/config"
 	appgit "workforge/internal/app/git"
@@ -12,6 +15,7 @@ import (
 	applog "workforge/internal/app/log"
 	"workforge/internal/app/plugin"
 	"workforge/internal/app/project"
+	"workforge/internal/app/state"
 	"workforge/internal/app/terminal"
 	"workforge/internal/infra/tmux"
 	"workforge/internal/util"
@@ -23,7 +27,13 @@ type Orchestrator struct {
 	git      *appgit.Service
 	hooks    *hook.HookService
 	terminal *terminal.TerminalService
+	state    *state.HookStateService
 	log      *applog.LogService
+	plugins  *plugin.PluginService
+
+	// cleanup makes Close and Interrupt, which may race on a signal, stop
+	// things only once.
+	cleanup sync.Once
 }
 
 func NewOrchestrator() *Orchestrator {
@@ -33,19 +43,24 @@ func NewOrchestrator() *Orchestrator {
 
 	pluginsDir := plugin.DefaultPluginsDir()
 	pluginRegistry := plugin.NewPluginRegistryService(plugin.DefaultRegistryPath())
-	pluginSvc := plugin.NewPluginService(pluginsDir, plugin.DefaultSocketsDir())
+	pluginSvc := plugin.NewPluginService(pluginsDir, plugin.DefaultSocketsDir(), pluginRegistry)
 	hookService := hook.NewHookService(pluginSvc, pluginRegistry)
 	logService := applog.NewLogService(hookService)
-	terminalService := terminal.NewTerminalService(hookService, logService)
+	stateService := state.NewHookStateService()
+	terminalService := terminal.NewTerminalService(hookService, logService, stateService)
 
-	return &Orchestrator{
+	o := &Orchestrator{
 		projects: projectService,
 		config:   configService,
 		git:      gitService,
 		hooks:    hookService,
 		terminal: terminalService,
+		state:    stateService,
 		log:      logService,
+		plugins:  pluginSvc,
 	}
+	pluginSvc.SetHostMethods(o.HostMethods())
+	return o
 }
 
 func (o *Orchestrator) Projects() *project.ProjectService {
@@ -64,10 +79,56 @@ func (o *Orchestrator) Hooks() *hook.HookService {
 	return o.hooks
 }
 
+// Plugins returns the plugin service, which serves the host methods to the
+// plugins it starts.
+func (o *Orchestrator) Plugins() *plugin.PluginService {
+	return o.plugins
+}
+
+func (o *Orchestrator) HookState() *state.HookStateService {
+	return o.state
+}
+
+// ProjectRoot returns the absolute directory of a registered project, the
+// key prefix of its worktrees in the hook state.
+func (o *Orchestrator) ProjectRoot(name string) (string, error) {
+	entry, err := o.projects.FindProjectEntry(name)
+	if err != nil {
+		return "", err
+	}
+	return absPath(entry.Path), nil
+}
+
 func (o *Orchestrator) Log() *applog.LogService {
 	return o.log
 }
 
+// Interrupt stops every per_command plugin started by this process. It is
+// called when wf receives SIGINT or SIGTERM.
+func (o *Orchestrator) Interrupt() {
+	o.shutdown(false)
+}
+
+// Close flushes queued log hooks and releases plugins before wf exits.
+// Background hook commands keep running until the project is closed.
+func (o *Orchestrator) Close() {
+	o.shutdown(true)
+}
+
+// shutdown runs the cleanup of Close or Interrupt, whichever comes first;
+// a later call waits for it to finish. flush waits for async plugin
+// notifications.
+func (o *Orchestrator) shutdown(flush bool) {
+	o.cleanup.Do(func() {
+		o.log.Close()
+		if flush {
+			o.hooks.Wait()
+		}
+		o.hooks.ReleasePlugins()
+		o.hooks.StopHost()
+	})
+}
+
 func (o *Orchestrator) InitProject(url string, gwt bool) error {
 	if url == "" {
 		return o.initLocal(gwt)
@@ -75,7 +136,7 @@ func (o *Orchestrator) InitProject(url string, gwt bool) error {
 	return o.initFromURL(url, gwt)
 }
 
-func (o *Orchestrator) LoadProject(path string, gwt bool, profile *string, projectName string) error {
+func (o *Orchestrator) LoadProject(ctx context.Context, path string, gwt bool, profile *string, projectName string) error {
 	if err := o.projects.EnterProjectDir(path); err != nil {
 		return err
 	}
@@ -83,34 +144,50 @@ func (o *Orchestrator) LoadProject(path string, gwt bool, profile *string, proje
 	if err != nil {
 		return fmt.Errorf("error loading config: %w", err)
 	}
-	currentProfile, err := o.config.SelectProfile(cfg, profile)
+	selection, err := o.selectProfile(cfg, profile, path)
 	if err != nil {
 		return err
 	}
+	currentProfile := selection.Name
 	o.config.SetLogLevel(cfg[currentProfile].LogLevel)
-	o.log.Debug("load", "using profile: %s", currentProfile)
+	o.log.Debug("load", "using profile: %s (%s)", currentProfile, selection.Reason)
 
 	resolvedProjectName := resolveProjectName(path, projectName)
-	extras := cfg[currentProfile].Extras
+	tpl, session, err := o.prepare(cfg, currentProfile, path, gwt, resolvedProjectName)
+	if err != nil {
+		return err
+	}
 
-	if err := o.terminal.RunCommands(hook.HookOnLoad, cfg[currentProfile].Hooks.OnLoad, resolvedProjectName, extras); err != nil {
+	preOpen := hook.NewPayload(resolvedProjectName, hook.HookPreOpen).
+		WithField(hook.FieldPath, session.Worktree).
+		WithField(hook.FieldBranch, session.Branch).
+		WithField(hook.FieldProfile, currentProfile).
+		WithConfig(session.PluginConfigs)
+	outcome, err := o.runPreHook(preOpen)
+	if err != nil {
 		return err
 	}
+	o.applyOutcome(&tpl, &session, outcome)
 
-	if cfg[currentProfile].Tmux == nil {
-		if err := o.terminal.RunCommands(hook.HookOnShellRunIn, cfg[currentProfile].Hooks.OnShellRunIn, resolvedProjectName, extras); err != nil {
+	if err := o.runHook(ctx, tpl, hook.HookOnLoad, session); err != nil {
+		return err
+	}
+
+	if tpl.Tmux == nil {
+		if err := o.runHook(ctx, tpl, hook.HookOnShellRunIn, session); err != nil {
 			return err
 		}
-		execErr := o.terminal.RunForeground(cfg[currentProfile].Foreground)
-		if err := o.terminal.RunCommands(hook.HookOnShellRunOut, cfg[currentProfile].Hooks.OnShellRunOut, resolvedProjectName, extras); err != nil {
+		execErr := o.terminal.RunForeground(ctx, tpl.Foreground, session)
+		if err := o.runHook(ctx, tpl, hook.HookOnShellRunOut, session); err != nil {
 			if execErr == nil {
 				return err
 			}
+			o.log.Error("load", err)
 		}
 		return execErr
 	}
 
-	tmuxCfg := cfg[currentProfile].Tmux
+	tmuxCfg := tpl.Tmux
 	sessionBase := tmuxCfg.SessionName
 	if sessionBase == "" {
 		if gwt {
@@ -124,7 +201,7 @@ func (o *Orchestrator) LoadProject(path string, gwt bool, profile *string, proje
 		sessionName = fmt.Sprintf("%s/%s", sessionBase, br)
 	}
 
-	if err := o.terminal.RunCommands(hook.HookOnShellRunIn, cfg[currentProfile].Hooks.OnShellRunIn, resolvedProjectName, extras); err != nil {
+	if err := o.runHook(ctx, tpl, hook.HookOnShellRunIn, session); err != nil {
 		return err
 	}
 
@@ -136,7 +213,11 @@ func (o *Orchestrator) LoadProject(path string, gwt bool, profile *string, proje
 		o.hooks.Run(payload)
 	}
 
-	if err := tmux.NewSession(path, sessionName, tmuxCfg.Attach, tmuxCfg.Windows, onWindowCreated); err != nil {
+	windows, err := windowCommands(tmuxCfg.Windows, tpl.Tasks, currentProfile)
+	if err != nil {
+		return err
+	}
+	if err := tmux.NewSession(path, sessionName, tmuxCfg.Attach, windows, session.Env, onWindowCreated); err != nil {
 		return fmt.Errorf("failed to start tmux session: %w", err)
 	}
 
@@ -144,22 +225,22 @@ func (o *Orchestrator) LoadProject(path string, gwt bool, profile *string, proje
 		WithSession(sessionName)
 	o.hooks.Run(sessionPayload)
 
-	if err := o.terminal.RunCommands(hook.HookOnShellRunOut, cfg[currentProfile].Hooks.OnShellRunOut, resolvedProjectName, extras); err != nil {
+	if err := o.runHook(ctx, tpl, hook.HookOnShellRunOut, session); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (o *Orchestrator) CloseProject(name string, profile *string) error {
+func (o *Orchestrator) CloseProject(ctx context.Context, name string, profile *string) error {
 	entry, err := o.projects.FindProjectEntry(name)
 	if err != nil {
 		return err
 	}
 
+	// A foreground profile has no tmux session, but on_close still runs and
+	// its background commands still need stopping.
 	sessionName := name
-	if !tmux.HasSession(sessionName) {
-		return fmt.Errorf("no tmux session found for %q", name)
-	}
+	hasSession := tmux.HasSession(sessionName)
 
 	cfg, err := o.config.LoadConfig(entry.Path, entry.IsGWT)
 	if err != nil {
@@ -167,23 +248,32 @@ func (o *Orchestrator) CloseProject(name string, profile *string) error {
 	}
 
 	if cfg != nil {
-		currentProfile, err := o.config.SelectProfile(cfg, profile)
+		selection, err := o.selectProfile(cfg, profile, entry.Path)
 		if err == nil {
-			if err := o.terminal.RunCommands(hook.HookOnClose, cfg[currentProfile].Hooks.OnClose, entry.Name, cfg[currentProfile].Extras); err != nil {
-				o.log.Warn("close", "on_close hook failed: %v", err)
+			tpl, session, err := o.prepare(cfg, selection.Name, entry.Path, entry.IsGWT, entry.Name)
+			if err != nil {
+				o.log.Warn("close", "could not expand config: %v", err)
+			} else if err := o.runHook(ctx, tpl, hook.HookOnClose, session); err != nil {
+				o.log.Error("close", fmt.Errorf("on_close hook failed: %w", err))
 			}
 		}
 	}
 
-	if err := tmux.KillSession(sessionName); err != nil {
-		return fmt.Errorf("failed to kill tmux session: %w", err)
+	if err := o.terminal.StopBackground(absPath(entry.Path)); err != nil {
+		o.log.Warn("close", "could not stop background commands: %v", err)
+	}
+
+	if hasSession {
+		if err := tmux.KillSession(sessionName); err != nil {
+			return fmt.Errorf("failed to kill tmux session: %w", err)
+		}
 	}
 
 	o.log.Success("close", "closed project %s", name)
 	return nil
 }
 
-func (o *Orchestrator) RunOnDelete(projectPath string, isGWT bool, profile *string, projectName string) error {
+func (o *Orchestrator) RunOnDelete(ctx context.Context, projectPath string, isGWT bool, profile *string, projectName string) error {
 	if err := o.projects.EnterProjectDir(projectPath); err != nil {
 		return err
 	}
@@ -191,25 +281,122 @@ func (o *Orchestrator) RunOnDelete(projectPath string, isGWT bool, profile *stri
 	if err != nil {
 		return fmt.Errorf("error loading config: %w", err)
 	}
-	currentProfile, err := o.config.SelectProfile(cfg, profile)
+	selection, err := o.selectProfile(cfg, profile, projectPath)
 	if err != nil {
 		return err
 	}
 
 	resolvedProjectName := resolveProjectName(projectPath, projectName)
-	if err := o.terminal.RunCommands(hook.HookOnDelete, cfg[currentProfile].Hooks.OnDelete, resolvedProjectName, cfg[currentProfile].Extras); err != nil {
+	tpl, session, err := o.prepare(cfg, selection.Name, projectPath, isGWT, resolvedProjectName)
+	if err != nil {
+		return err
+	}
+	preDelete := hook.NewPayload(resolvedProjectName, hook.HookPreDelete).
+		WithField(hook.FieldPath, session.Worktree).
+		WithField(hook.FieldBranch, session.Branch).
+		WithConfig(session.PluginConfigs)
+	if _, err := o.runPreHook(preDelete); err != nil {
+		return err
+	}
+	if err := o.runHook(ctx, tpl, hook.HookOnDelete, session); err != nil {
 		return err
 	}
+	if err := o.terminal.StopBackground(session.Worktree); err != nil {
+		o.log.Warn("delete", "could not stop background commands: %v", err)
+	}
 
 	return nil
 }
 
-func (o *Orchestrator) RemoveWorktree(name string) (string, error) {
+// ExplainProfile reports which profile LoadProject would use for path and why.
+func (o *Orchestrator) ExplainProfile(path string, gwt bool, profile *string) (config.ProfileSelection, error) {
+	cfg, err := o.config.LoadConfig(path, gwt)
+	if err != nil {
+		return config.ProfileSelection{}, fmt.Errorf("error loading config: %w", err)
+	}
+	return o.selectProfile(cfg, profile, path)
+}
+
+// ProjectEnv resolves the environment a project's commands run with.
+func (o *Orchestrator) ProjectEnv(projectName string, profile *string) ([]string, error) {
+	_, session, err := o.resolveProject(projectName, profile)
+	if err != nil {
+		return nil, err
+	}
+	return session.Env, nil
+}
+
+// RunTask runs a named task, and its dependencies, for a registered project
+// or for the project in the current directory when projectName is empty.
+func (o *Orchestrator) RunTask(ctx context.Context, taskName string, projectName string, profile *string) error {
+	tpl, session, err := o.resolveProject(projectName, profile)
+	if err != nil {
+		return err
+	}
+	return o.terminal.RunTask(ctx, tpl.Tasks, taskName, session)
+}
+
+func (o *Orchestrator) ListTasks(projectName string, profile *string) (map[string]config.Task, error) {
+	tpl, _, err := o.resolveProject(projectName, profile)
+	if err != nil {
+		return nil, err
+	}
+	return tpl.Tasks, nil
+}
+
+// resolveProject enters a project directory and prepares its profile
+// without running any hooks.
+func (o *Orchestrator) resolveProject(projectName string, profile *string) (config.Template, terminal.Session, error) {
+	var entry project.ProjectEntry
+	if projectName != "" {
+		found, err := o.projects.FindProjectEntry(projectName)
+		if err != nil {
+			return config.Template{}, terminal.Session{}, err
+		}
+		entry = found
+	} else {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return config.Template{}, terminal.Session{}, fmt.Errorf("error getting current directory: %w", err)
+		}
+		found, ok := o.projects.FindProjectEntryByPath(cwd)
+		if !ok {
+			cfgPath, err := o.config.FindConfigPath(cwd)
+			if err != nil {
+				return config.Template{}, terminal.Session{}, err
+			}
+			found = project.ProjectEntry{
+				Project: project.Project{Name: filepath.Base(cwd), Path: cwd},
+				IsGWT:   filepath.Dir(cfgPath) != cwd,
+			}
+		}
+		entry = found
+	}
+
+	if err := o.projects.EnterProjectDir(entry.Path); err != nil {
+		return config.Template{}, terminal.Session{}, err
+	}
+	cfg, err := o.config.LoadConfig(entry.Path, entry.IsGWT)
+	if err != nil {
+		return config.Template{}, terminal.Session{}, fmt.Errorf("error loading config: %w", err)
+	}
+	selection, err := o.selectProfile(cfg, profile, entry.Path)
+	if err != nil {
+		return config.Template{}, terminal.Session{}, err
+	}
+	o.config.SetLogLevel(cfg[selection.Name].LogLevel)
+	return o.prepare(cfg, selection.Name, entry.Path, entry.IsGWT, entry.Name)
+}
+
+func (o *Orchestrator) RemoveWorktree(ctx context.Context, name string) (string, error) {
 	leafPath, err := o.projects.ResolveWorktreeLeaf(name)
 	if err != nil {
 		return "", err
 	}
-	return appgit.RemoveWorktree(leafPath, name, o.RunOnDelete)
+	onDelete := func(projectPath string, isGWT bool, profile *string, projectName string) error {
+		return o.RunOnDelete(ctx, projectPath, isGWT, profile, projectName)
+	}
+	return appgit.RemoveWorktree(leafPath, name, onDelete)
 }
 
 func (o *Orchestrator) initFromURL(url string, gwt bool) error {
@@ -294,6 +481,138 @@ func (o *Orchestrator) initLocal(gwt bool) error {
 	return o.projects.AddProject(repoName, gwt, nil)
 }
 
+func (o *Orchestrator) selectProfile(cfg config.Config, requested *string, path string) (config.ProfileSelection, error) {
+	target := config.MatchTarget{Path: absPath(path)}
+	if br, err := o.git.CurrentBranchForPath(path); err == nil {
+		target.Branch = br
+	}
+	return o.config.SelectProfile(cfg, requested, target)
+}
+
+// runHook runs a shell hook under its configured hooks.timeout, if any.
+func (o *Orchestrator) runHook(ctx context.Context, tpl config.Template, hookType hook.HookType, session terminal.Session) error {
+	if timeout := tpl.Hooks.Timeout[string(hookType)]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return o.terminal.RunCommands(ctx, hookType, tpl.Hooks.Get(string(hookType)), session)
+}
+
+// runPreHook dispatches a pre-hook and merges the plugin replies. The
+// operation is aborted when a plugin asks for it and also when one fails,
+// so that a crashed or timed-out guard cannot be bypassed.
+func (o *Orchestrator) runPreHook(payload *hook.HookPayload) (hook.Outcome, error) {
+	results := o.hooks.Run(payload)
+	for _, r := range results {
+		if r.Error != nil {
+			continue
+		}
+		o.log.Debug("plugin", "%s %s took %s", r.PluginName, payload.Type, r.Duration.Round(time.Millisecond))
+	}
+	return hook.Merge(payload.Type, results)
+}
+
+// applyOutcome adds the env variables and tmux windows returned by pre_open
+// plugins. Reserved WF_* variables cannot be overridden.
+func (o *Orchestrator) applyOutcome(tpl *config.Template, session *terminal.Session, outcome hook.Outcome) {
+	if len(outcome.Env) > 0 {
+		env := make(map[string]string, len(outcome.Env))
+		for k, v := range outcome.Env {
+			if config.IsReservedEnv(k) {
+				o.log.Warn("plugin", "ignoring %s from plugin env: reserved", k)
+				continue
+			}
+			env[k] = v
+		}
+		session.Env = append(session.Env, config.EnvList(env)...)
+		o.log.SetShellHooks(o.terminal.LogHooks(tpl.Hooks, *session))
+	}
+	if len(outcome.Windows) > 0 {
+		if tpl.Tmux == nil {
+			o.log.Warn("plugin", "ignoring windows from plugins: tmux is not configured")
+			return
+		}
+		tmuxCfg := *tpl.Tmux
+		tmuxCfg.Windows = append(append([]string{}, tmuxCfg.Windows...), outcome.Windows...)
+		tpl.Tmux = &tmuxCfg
+	}
+}
+
+// prepare expands the selected profile and builds the session environment
+// shared by its hooks, foreground command and tmux windows.
+func (o *Orchestrator) prepare(cfg config.Config, profile string, path string, gwt bool, projectName string) (config.Template, terminal.Session, error) {
+	tpl, session, err := o.expand(cfg, profile, path, gwt, projectName)
+	if err != nil {
+		return config.Template{}, terminal.Session{}, err
+	}
+	o.log.SetShellHooks(o.terminal.LogHooks(tpl.Hooks, session))
+	return tpl, session, nil
+}
+
+// expand is prepare without side effects on the running process.
+func (o *Orchestrator) expand(cfg config.Config, profile string, path string, gwt bool, projectName string) (config.Template, terminal.Session, error) {
+	scope := config.Scope{
+		Project:  projectName,
+		Worktree: absPath(path),
+		Root:     absPath(filepath.Dir(o.config.ResolveConfigPath(path, gwt))),
+		Profile:  profile,
+	}
+	if br, err := o.git.CurrentBranchForPath(path); err == nil {
+		scope.Branch = br
+	}
+	tpl, err := o.config.ExpandTemplate(cfg[profile], scope)
+	if err != nil {
+		return config.Template{}, terminal.Session{}, fmt.Errorf("profile %q: %w", profile, err)
+	}
+	env, err := o.config.ResolveEnv(tpl, scope)
+	if err != nil {
+		return config.Template{}, terminal.Session{}, fmt.Errorf("profile %q: %w", profile, err)
+	}
+	session := terminal.Session{
+		Project:       projectName,
+		Worktree:      scope.Worktree,
+		Branch:        scope.Branch,
+		PluginConfigs: tpl.Extras,
+		Env:           config.EnvList(env),
+	}
+	return tpl, session, nil
+}
+
+// windowCommands replaces "task:<name>" windows with a `wf task` invocation
+// for the same profile.
+func windowCommands(windows []string, tasks map[string]config.Task, profile string) ([]string, error) {
+	out := make([]string, len(windows))
+	for i, win := range windows {
+		name, isTask := strings.CutPrefix(strings.TrimSpace(win), config.TaskWindowPrefix)
+		if !isTask {
+			out[i] = win
+			continue
+		}
+		if _, ok := tasks[name]; !ok {
+			return nil, fmt.Errorf("tmux window %d: task %q not found", i, name)
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("tmux window %d: resolve wf executable: %w", i, err)
+		}
+		out[i] = fmt.Sprintf("%s task %s --profile %s", shellQuote(exe), shellQuote(name), shellQuote(profile))
+	}
+	return out, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
 func resolveProjectName(path string, projectName string) string {
 	name := strings.TrimSpace(projectName)
 	if name != "" {
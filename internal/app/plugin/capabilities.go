@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNotGranted is returned when the user declines the capabilities a
+// plugin requests.
+var ErrNotGranted = errors.New("capabilities not granted")
+
+// Capabilities lists what a plugin may do. Requested in plugin.json and
+// stored as granted in plugins.json once the user approves them.
+type Capabilities struct {
+	// Hooks the plugin subscribes to.
+	Hooks []string `json:"hooks,omitempty"`
+	// Host lists the workforge methods the plugin may call, e.g.
+	// "projects.list".
+	Host []string `json:"host,omitempty"`
+	// Env lists the environment variables passed to the plugin besides a
+	// minimal base set; "*" passes the whole environment.
+	Env []string `json:"env,omitempty"`
+	// Network declares that the plugin talks to the network. It is shown
+	// to the user but not enforced.
+	Network bool `json:"network,omitempty"`
+}
+
+// Approver decides whether to grant requested capabilities. granted holds
+// what the plugin was granted before, nil on first install.
+type Approver func(name string, requested Capabilities, granted *Capabilities) bool
+
+// IsZero reports whether c requests nothing.
+func (c Capabilities) IsZero() bool {
+	return len(c.Hooks) == 0 && len(c.Host) == 0 && len(c.Env) == 0 && !c.Network
+}
+
+// Missing returns the part of c not covered by granted.
+func (c Capabilities) Missing(granted Capabilities) Capabilities {
+	return Capabilities{
+		Hooks:   subtract(c.Hooks, granted.Hooks),
+		Host:    subtract(c.Host, granted.Host),
+		Env:     subtractEnv(c.Env, granted.Env),
+		Network: c.Network && !granted.Network,
+	}
+}
+
+func subtract(items, have []string) []string {
+	var out []string
+	for _, item := range items {
+		if !contains(have, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func subtractEnv(items, have []string) []string {
+	if contains(have, "*") {
+		return nil
+	}
+	return subtract(items, have)
+}
+
+func contains(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
+
+func union(a, b []string) []string {
+	out := append([]string(nil), a...)
+	for _, item := range b {
+		if !contains(out, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// baseEnv is passed to every plugin regardless of its env capability.
+var baseEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "TERM", "TMPDIR", "TZ"}
+
+// pluginEnv filters environ down to the base set, the LC_* and XDG_*
+// variables, what runtime needs and the variables in allowed.
+func pluginEnv(environ []string, runtime string, allowed []string) []string {
+	if contains(allowed, "*") {
+		return append([]string(nil), environ...)
+	}
+	var out []string
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if contains(baseEnv, key) || contains(allowed, key) || contains(runtimeEnv[runtime], key) ||
+			strings.HasPrefix(key, "LC_") || strings.HasPrefix(key, "XDG_") {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// grantedFor returns what the registered plugin name was granted. Plugins
+// registered before capabilities existed keep their hooks and the full
+// environment until they are approved again on update.
+func (s *PluginService) grantedFor(name string) Capabilities {
+	if s.registry == nil {
+		return Capabilities{}
+	}
+	entry, ok := s.registry.Find(name)
+	if !ok {
+		return Capabilities{}
+	}
+	if entry.Granted == nil {
+		return Capabilities{Hooks: entry.Hooks, Env: []string{"*"}}
+	}
+	return *entry.Granted
+}
@@ -0,0 +1,232 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Notification is a JSON-RPC request without an id; the plugin must not
+// answer it.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+const (
+	callTimeout  = 30 * time.Second
+	writeTimeout = 5 * time.Second
+	// aliveWindow is how long after its last answer a plugin reached over
+	// a closed connection is still taken to be running.
+	aliveWindow = 30 * time.Second
+)
+
+// errConnClosed is returned for requests still waiting when the plugin
+// closes the connection.
+var errConnClosed = errors.New("connection closed by plugin")
+
+// errNotSent is returned when a request never reached the plugin, so it is
+// safe to send it again on a new connection.
+var errNotSent = errors.New("request not sent")
+
+// rpcConn is a persistent connection to a plugin. Requests from several
+// goroutines share it and responses are matched to them by id, so they
+// may arrive in any order.
+type rpcConn struct {
+	conn net.Conn
+	// single is set for a connection that carries one request and is then
+	// closed, for legacy plugins.
+	single bool
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu      sync.Mutex
+	pending map[int]chan Response
+	closed  bool
+	// lastReply is when the plugin last answered a request.
+	lastReply time.Time
+}
+
+func dialRPC(socketPath string) (*rpcConn, error) {
+	conn, err := net.DialTimeout("unix", socketPath, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &rpcConn{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: make(map[int]chan Response),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *rpcConn) readLoop() {
+	dec := json.NewDecoder(c.conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			c.close()
+			return
+		}
+		var responses []Response
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(raw, &responses); err != nil {
+				continue
+			}
+		} else {
+			var resp Response
+			if err := json.Unmarshal(raw, &resp); err != nil {
+				continue
+			}
+			responses = []Response{resp}
+		}
+		for _, resp := range responses {
+			c.deliver(resp)
+		}
+	}
+}
+
+func (c *rpcConn) deliver(resp Response) {
+	c.mu.Lock()
+	ch, ok := c.pending[resp.ID]
+	delete(c.pending, resp.ID)
+	c.lastReply = time.Now()
+	c.mu.Unlock()
+	if ok {
+		ch <- resp
+	}
+}
+
+func (c *rpcConn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// answeredWithin reports whether the plugin answered a request on this
+// connection in the last d.
+func (c *rpcConn) answeredWithin(d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.lastReply.IsZero() && time.Since(c.lastReply) < d
+}
+
+func (c *rpcConn) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	c.conn.Close()
+	for _, ch := range pending {
+		close(ch)
+	}
+}
+
+func (c *rpcConn) write(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := c.enc.Encode(v); err != nil {
+		c.close()
+		return fmt.Errorf("send request: %w: %w", errNotSent, err)
+	}
+	return nil
+}
+
+func (c *rpcConn) register(ids ...int) (map[int]chan Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("%w: %w", errNotSent, errConnClosed)
+	}
+	chans := make(map[int]chan Response, len(ids))
+	for _, id := range ids {
+		ch := make(chan Response, 1)
+		c.pending[id] = ch
+		chans[id] = ch
+	}
+	return chans, nil
+}
+
+func (c *rpcConn) unregister(ids ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		delete(c.pending, id)
+	}
+}
+
+// call sends req and waits for the response with the same id.
+func (c *rpcConn) call(req Request) (Response, error) {
+	chans, err := c.register(req.ID)
+	if err != nil {
+		return Response{}, err
+	}
+	if err := c.write(req); err != nil {
+		c.unregister(req.ID)
+		return Response{}, err
+	}
+	return c.wait(req.ID, chans[req.ID], time.After(callTimeout))
+}
+
+// batch sends reqs as one JSON-RPC batch and returns the responses in the
+// order of reqs.
+func (c *rpcConn) batch(reqs []Request) ([]Response, error) {
+	ids := make([]int, len(reqs))
+	for i, req := range reqs {
+		ids[i] = req.ID
+	}
+	chans, err := c.register(ids...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.write(reqs); err != nil {
+		c.unregister(ids...)
+		return nil, err
+	}
+	timeout := time.After(callTimeout)
+	out := make([]Response, len(reqs))
+	for i, id := range ids {
+		resp, err := c.wait(id, chans[id], timeout)
+		if err != nil {
+			c.unregister(ids[i:]...)
+			return nil, err
+		}
+		out[i] = resp
+	}
+	return out, nil
+}
+
+func (c *rpcConn) wait(id int, ch chan Response, timeout <-chan time.Time) (Response, error) {
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return Response{}, errConnClosed
+		}
+		return resp, nil
+	case <-timeout:
+		c.unregister(id)
+		return Response{}, fmt.Errorf("read response: timeout after %s", callTimeout)
+	}
+}
+
+// notify sends notifications, batched when there are several.
+func (c *rpcConn) notify(notes []Notification) error {
+	if len(notes) == 1 {
+		return c.write(notes[0])
+	}
+	return c.write(notes)
+}
@@ -0,0 +1,305 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	execinfra "workforge/internal/infra/exec"
+)
+
+// recordedStopTimeout is how long a plugin started by another wf process
+// gets to exit after "shutdown" before it is killed.
+const recordedStopTimeout = 2 * time.Second
+
+// pidRecord is written next to a plugin's socket by the wf process that
+// started it, so that any wf process can find, stop and report on it. The
+// file's modification time is when the plugin was last used.
+type pidRecord struct {
+	PID int `json:"pid"`
+	// Start identifies the process behind PID (see execinfra.ProcessStart),
+	// so that a reused PID is never taken for the plugin.
+	Start     string    `json:"start,omitempty"`
+	Started   time.Time `json:"started"`
+	Lifecycle string    `json:"lifecycle"`
+	// IdleTimeout is in seconds; zero for plugins never stopped for
+	// being idle.
+	IdleTimeout int  `json:"idle_timeout,omitempty"`
+	Group       bool `json:"group,omitempty"`
+}
+
+func (r *pidRecord) idleAfter() time.Duration {
+	return time.Duration(r.IdleTimeout) * time.Second
+}
+
+// running reports whether the recorded process is still the plugin.
+func (r *pidRecord) running() bool {
+	return execinfra.SameProcess(r.PID, r.Start)
+}
+
+// RunningPlugin describes a plugin process found in the sockets dir.
+type RunningPlugin struct {
+	Name      string
+	PID       int
+	Lifecycle string
+	Started   time.Time
+	LastUsed  time.Time
+	// IdleTimeout is zero for plugins never stopped for being idle.
+	IdleTimeout time.Duration
+	// Memory is the resident set size in bytes, or -1 when unknown.
+	Memory int64
+}
+
+func (s *PluginService) pidPath(name string) string {
+	return filepath.Join(s.socketsDir, name+".pid")
+}
+
+func (s *PluginService) writePid(name string, info *PluginInfo) error {
+	data, err := json.Marshal(pidRecord{
+		PID:         info.Process.Pid,
+		Start:       execinfra.ProcessStart(info.Process.Pid),
+		Started:     info.started,
+		Lifecycle:   info.lifecycle,
+		IdleTimeout: int(info.idleAfter / time.Second),
+		Group:       info.group,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.pidPath(name), data, 0o600)
+}
+
+// readPid returns the pidfile of name and when the plugin was last used.
+func (s *PluginService) readPid(name string) (*pidRecord, time.Time, error) {
+	path := s.pidPath(name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var rec pidRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, time.Time{}, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &rec, st.ModTime(), nil
+}
+
+// removePid removes the pidfile of name if it still belongs to pid.
+func (s *PluginService) removePid(name string, pid int) {
+	if rec, _, err := s.readPid(name); err == nil && rec.PID == pid {
+		os.Remove(s.pidPath(name))
+	}
+}
+
+// ensureSocketsDir creates the sockets dir if needed and checks that it is
+// a directory of the current user that nobody else can write to, since
+// wf connects to the sockets and signals the processes recorded there.
+func (s *PluginService) ensureSocketsDir() error {
+	if err := os.MkdirAll(s.socketsDir, 0o700); err != nil {
+		return err
+	}
+	fi, err := os.Lstat(s.socketsDir)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	switch {
+	case !fi.IsDir():
+		return fmt.Errorf("sockets dir %s is not a directory", s.socketsDir)
+	case !ok || int(st.Uid) != os.Getuid():
+		return fmt.Errorf("sockets dir %s is not owned by the current user", s.socketsDir)
+	case fi.Mode().Perm()&0o077 != 0:
+		return fmt.Errorf("sockets dir %s is accessible to other users (mode %s)", s.socketsDir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// lockStart takes the per-plugin lock in the sockets dir that serializes
+// starting and stopping a plugin across wf processes.
+func (s *PluginService) lockStart(name string) (func(), error) {
+	if err := s.ensureSocketsDir(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(s.socketsDir, name+".lock"), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// touch records that a plugin was just used and restarts its idle timer.
+// Callers hold mu.
+func (s *PluginService) touch(info *PluginInfo) {
+	now := time.Now()
+	os.Chtimes(s.pidPath(info.Name), now, now)
+	if info.idleAfter <= 0 {
+		return
+	}
+	if info.idle != nil {
+		info.idle.Reset(info.idleAfter)
+		return
+	}
+	name := info.Name
+	info.idle = time.AfterFunc(info.idleAfter, func() { s.stopIfIdle(name) })
+}
+
+// stopIfIdle stops an on_demand plugin nobody, in this or another wf
+// process, has used for its idle timeout.
+func (s *PluginService) stopIfIdle(name string) {
+	rec, lastUsed, err := s.readPid(name)
+	if err != nil || rec.idleAfter() <= 0 {
+		return
+	}
+	if remaining := rec.idleAfter() - time.Since(lastUsed); remaining > 0 {
+		s.mu.Lock()
+		if info, ok := s.plugins[name]; ok && info.idle != nil {
+			info.idle.Reset(remaining)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.logEvent(name, "unused for %s; stopping", rec.idleAfter())
+	s.Kill(name)
+}
+
+// Running lists the plugin processes recorded in the sockets dir,
+// whichever wf process started them. Stale pidfiles are removed.
+func (s *PluginService) Running() []RunningPlugin {
+	if err := s.ensureSocketsDir(); err != nil {
+		return nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(s.socketsDir, "*.pid"))
+	var running []RunningPlugin
+	for _, path := range matches {
+		name := strings.TrimSuffix(filepath.Base(path), ".pid")
+		rec, lastUsed, err := s.readPid(name)
+		if err != nil {
+			continue
+		}
+		if !rec.running() {
+			os.Remove(path)
+			continue
+		}
+		running = append(running, RunningPlugin{
+			Name:        name,
+			PID:         rec.PID,
+			Lifecycle:   rec.Lifecycle,
+			Started:     rec.Started,
+			LastUsed:    lastUsed,
+			IdleTimeout: rec.idleAfter(),
+			Memory:      processMemory(rec.PID),
+		})
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].Name < running[j].Name })
+	return running
+}
+
+// Release is called when a wf command ends. It stops the per_command
+// plugins this process uses and every on_demand plugin idle past its
+// timeout; other plugins keep running for later wf processes.
+func (s *PluginService) Release() {
+	s.mu.Lock()
+	var stop []string
+	for name, info := range s.plugins {
+		if info.idle != nil {
+			info.idle.Stop()
+			info.idle = nil
+		}
+		if info.lifecycle == LifecyclePerCommand {
+			stop = append(stop, name)
+			continue
+		}
+		// Not ours to stop: forget it without letting the supervisor
+		// mistake wf exiting for a crash.
+		info.stopping = true
+		if info.conn != nil {
+			info.conn.close()
+		}
+	}
+	s.mu.Unlock()
+
+	for _, name := range stop {
+		s.Kill(name)
+	}
+	for _, p := range s.Running() {
+		if p.IdleTimeout > 0 && time.Since(p.LastUsed) >= p.IdleTimeout {
+			s.logEvent(p.Name, "unused for %s; stopping", p.IdleTimeout)
+			s.Kill(p.Name)
+		}
+	}
+}
+
+// stopRecorded stops a plugin started by another wf process: it asks it
+// to shut down and kills it if it is still running after timeout.
+func (s *PluginService) stopRecorded(name string, timeout time.Duration) error {
+	socketPath := filepath.Join(s.socketsDir, name+".sock")
+	rec, _, err := s.readPid(name)
+	if errors.Is(err, os.ErrNotExist) {
+		// Started by a wf without pidfiles: all we can do is ask.
+		if s.isSocketAlive(socketPath) {
+			s.callShutdown(&PluginInfo{Name: name, SocketPath: socketPath})
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Only signal the recorded pid while it is still the plugin.
+	if rec.running() && s.isSocketAlive(socketPath) {
+		s.callShutdown(&PluginInfo{Name: name, SocketPath: socketPath})
+		deadline := time.Now().Add(timeout)
+		for rec.running() && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if rec.running() {
+			pid := rec.PID
+			if rec.Group {
+				pid = -pid
+			}
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	}
+	os.Remove(s.pidPath(name))
+	os.Remove(socketPath)
+	return nil
+}
+
+// processMemory returns the resident set size of pid from /proc, or -1
+// where that is not available.
+func processMemory(pid int) int64 {
+	f, err := os.Open(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return -1
+			}
+			return kb * 1024
+		}
+	}
+	return -1
+}
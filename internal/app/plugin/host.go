@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// HostSocketEnv names the environment variable that tells a plugin where
+// to call back into workforge. The path is also its second argument.
+const HostSocketEnv = "WF_HOST_SOCKET"
+
+// JSON-RPC error codes used by the host endpoint.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInternalError  = -32603
+	CodeNotPermitted   = -32000
+)
+
+// hostRequest is a call from a plugin. ID is kept as sent, since JSON-RPC
+// allows strings as well as numbers; it is empty for a notification.
+type hostRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// hostResponse answers a hostRequest with its ID echoed back, or null when
+// the request could not be read.
+type hostResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+var nullID = json.RawMessage("null")
+
+// HostMethod serves a call from the plugin named caller.
+type HostMethod func(caller string, params json.RawMessage) (interface{}, error)
+
+// hostServer is the endpoint one plugin uses to call workforge. Only the
+// methods the plugin declares in its capabilities are served.
+type hostServer struct {
+	name     string
+	path     string
+	listener net.Listener
+	allowed  map[string]bool
+	methods  map[string]HostMethod
+}
+
+func (s *PluginService) hostSocketPath(name string) string {
+	return filepath.Join(s.socketsDir, name+".host.sock")
+}
+
+// SetHostMethods registers the methods plugins may call back into.
+func (s *PluginService) SetHostMethods(methods map[string]HostMethod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hostMethods = methods
+}
+
+// serveHost starts the host endpoint of a plugin unless this or another wf
+// process already serves it. Plugins outlive the wf process that started
+// them, so whichever process wakes a plugin takes over its endpoint.
+func (s *PluginService) serveHost(name string, allowed []string) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.hosts[name]; ok {
+		return nil
+	}
+	path := s.hostSocketPath(name)
+	if s.isSocketAlive(path) {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cleanup old host socket: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen on host socket: %w", err)
+	}
+
+	host := &hostServer{
+		name:     name,
+		path:     path,
+		listener: listener,
+		allowed:  make(map[string]bool, len(allowed)),
+		methods:  s.hostMethods,
+	}
+	for _, method := range allowed {
+		host.allowed[method] = true
+	}
+	s.hosts[name] = host
+	go host.serve()
+	return nil
+}
+
+// StopHost closes every host endpoint served by this process.
+func (s *PluginService) StopHost() {
+	s.mu.Lock()
+	hosts := s.hosts
+	s.hosts = make(map[string]*hostServer)
+	s.mu.Unlock()
+	for _, host := range hosts {
+		host.listener.Close()
+		os.Remove(host.path)
+	}
+}
+
+func (h *hostServer) serve() {
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+		go h.serveConn(conn)
+	}
+}
+
+func (h *hostServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	var writeMu sync.Mutex
+	enc := json.NewEncoder(conn)
+	reply := func(resp hostResponse) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		enc.Encode(resp)
+	}
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			// Nothing after malformed JSON can be read reliably.
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				reply(hostResponse{JSONRPC: "2.0", ID: nullID, Error: &RPCError{Code: CodeParseError, Message: err.Error()}})
+			}
+			return
+		}
+		var req hostRequest
+		if err := json.Unmarshal(raw, &req); err != nil || req.Method == "" {
+			id := req.ID
+			if err != nil || len(id) == 0 {
+				id = nullID
+			}
+			reply(hostResponse{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: CodeInvalidRequest, Message: "invalid request"}})
+			continue
+		}
+		go func() {
+			resp := h.handle(req.Method, req.Params)
+			if len(req.ID) == 0 {
+				return
+			}
+			resp.ID = req.ID
+			reply(resp)
+		}()
+	}
+}
+
+func (h *hostServer) handle(method string, params json.RawMessage) hostResponse {
+	resp := hostResponse{JSONRPC: "2.0"}
+	fn, ok := h.methods[method]
+	if !ok {
+		resp.Error = &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+		return resp
+	}
+	if !h.allowed[method] {
+		resp.Error = &RPCError{Code: CodeNotPermitted, Message: fmt.Sprintf("plugin %q has no capability for %q", h.name, method)}
+		return resp
+	}
+	result, err := fn(h.name, params)
+	if err != nil {
+		resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		return resp
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		return resp
+	}
+	resp.Result = data
+	return resp
+}
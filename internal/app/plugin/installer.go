@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,88 +12,183 @@ import (
 type PluginInstallerService struct {
 	pluginsDir string
 	registry   *PluginRegistryService
+	lockPath   string
+	rules      ManifestRules
+
+	buildOutput io.Writer
 }
 
-func NewPluginInstallerService(pluginsDir string, registry *PluginRegistryService) *PluginInstallerService {
+func NewPluginInstallerService(pluginsDir string, registry *PluginRegistryService, lockPath string, rules ManifestRules) *PluginInstallerService {
 	return &PluginInstallerService{
 		pluginsDir: pluginsDir,
 		registry:   registry,
+		lockPath:   lockPath,
+		rules:      rules,
 	}
 }
 
-func (s *PluginInstallerService) Install(url string) (*PluginEntry, error) {
+// SetBuildOutput sets where plugin build steps print, announced by a
+// "Building plugin" line.
+func (s *PluginInstallerService) SetBuildOutput(w io.Writer) {
+	s.buildOutput = w
+}
+
+// Install installs the plugin at source and registers it once approve
+// grants the capabilities it requests. source is a git URL, optionally
+// "url@ref" with a tag or commit, a local directory, a file:// URL or a
+// .tar.gz or .zip archive path or URL.
+func (s *PluginInstallerService) Install(source string, opts InstallOptions, approve Approver) (*PluginEntry, error) {
+	kind, path := sourceKind(source)
+	if kind != SourceArchive && opts.SHA256 != "" {
+		return nil, fmt.Errorf("--sha256 applies to archives only")
+	}
+	if kind != SourcePath && opts.Link {
+		return nil, fmt.Errorf("--link applies to local directories only")
+	}
+	switch kind {
+	case SourceArchive:
+		return s.installArchive(path, opts.SHA256, approve)
+	case SourcePath:
+		return s.installLocal(path, opts.Link, approve)
+	}
+
+	url, ref := SplitSource(source)
+	entry, err := s.install(url, ref, ref, approve)
+	if err != nil {
+		return nil, err
+	}
+	return entry, s.writeLock()
+}
+
+// install clones url, checks out rev when set and registers the plugin as
+// pinned to ref. The clone is placed in the directory named after the
+// manifest, where Wakeup looks for it.
+func (s *PluginInstallerService) install(url, rev, ref string, approve Approver) (*PluginEntry, error) {
 	if err := os.MkdirAll(s.pluginsDir, 0o755); err != nil {
 		return nil, fmt.Errorf("create plugins dir: %w", err)
 	}
 
-	name := extractRepoName(url)
-	pluginPath := filepath.Join(s.pluginsDir, name)
-
-	if _, err := os.Stat(pluginPath); err == nil {
-		return nil, fmt.Errorf("plugin %q already exists at %s", name, pluginPath)
+	tmp, err := os.MkdirTemp(s.pluginsDir, ".clone-")
+	if err != nil {
+		return nil, err
 	}
+	defer os.RemoveAll(tmp)
+	clonePath := filepath.Join(tmp, extractRepoName(url))
 
-	cmd := exec.Command("git", "clone", url, pluginPath)
+	cmd := exec.Command("git", "clone", url, clonePath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("git clone failed: %w", err)
 	}
 
-	manifest, err := LoadManifest(pluginPath)
+	commit, err := gitOutput(clonePath, "rev-parse", "HEAD")
+	if err == nil && rev != "" {
+		// A branch other than the default exists only as origin/<branch>.
+		if commit, err = target(clonePath, rev); err == nil {
+			commit, err = checkout(clonePath, commit)
+		}
+	}
 	if err != nil {
-		os.RemoveAll(pluginPath)
-		return nil, fmt.Errorf("invalid plugin (no plugin.json): %w", err)
+		return nil, err
 	}
 
-	entry := PluginEntry{
-		Name:       manifest.Name,
-		URL:        url,
-		ConfigKey:  manifest.ConfigKey,
-		Hooks:      manifest.Hooks,
-		Entrypoint: manifest.Entrypoint,
-		Runtime:    manifest.Runtime,
+	manifest, err := s.loadManifest(clonePath, "")
+	if err != nil {
+		return nil, err
+	}
+	pluginPath, err := s.destination(manifest.Name)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.registry.Add(entry); err != nil {
-		return nil, fmt.Errorf("register plugin: %w", err)
+	if !approve(manifest.Name, manifest.Capabilities, nil) {
+		return nil, ErrNotGranted
+	}
+	if err := os.Rename(clonePath, pluginPath); err != nil {
+		return nil, fmt.Errorf("install plugin: %w", err)
+	}
+	if err := s.build(manifest, pluginPath); err != nil {
+		os.RemoveAll(pluginPath)
+		return nil, err
 	}
 
-	return &entry, nil
+	entry := entryFromManifest(manifest, url)
+	entry.Source = SourceGit
+	entry.Ref = ref
+	entry.Commit = commit
+	return s.register(entry)
 }
 
+// Uninstall removes a plugin and its directory. A plugin installed with
+// --link only loses its symlink; the linked source tree is kept.
 func (s *PluginInstallerService) Uninstall(name string) error {
 	pluginPath := filepath.Join(s.pluginsDir, name)
 
-	if err := os.RemoveAll(pluginPath); err != nil {
+	if info, err := os.Lstat(pluginPath); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(pluginPath); err != nil {
+			return fmt.Errorf("remove plugin link: %w", err)
+		}
+	} else if err := os.RemoveAll(pluginPath); err != nil {
 		return fmt.Errorf("remove plugin dir: %w", err)
 	}
 
-	return s.registry.Remove(name)
+	if err := s.registry.Remove(name); err != nil {
+		return err
+	}
+	return s.writeLock()
 }
 
-func (s *PluginInstallerService) Register(name string) error {
+// Register adds an existing plugin directory to the registry. approve is
+// asked again only when the plugin requests more than it was granted.
+func (s *PluginInstallerService) Register(name string, approve Approver) error {
 	pluginPath := filepath.Join(s.pluginsDir, name)
 
 	if _, err := os.Stat(pluginPath); err != nil {
 		return fmt.Errorf("plugin directory not found: %s", pluginPath)
 	}
 
-	manifest, err := LoadManifest(pluginPath)
+	manifest, err := s.loadManifest(pluginPath, name)
 	if err != nil {
-		return fmt.Errorf("invalid plugin (no plugin.json): %w", err)
+		return err
 	}
 
-	entry := PluginEntry{
-		Name:       manifest.Name,
-		URL:        "local",
-		ConfigKey:  manifest.ConfigKey,
-		Hooks:      manifest.Hooks,
-		Entrypoint: manifest.Entrypoint,
-		Runtime:    manifest.Runtime,
+	if err := s.approve(name, manifest, approve); err != nil {
+		return err
 	}
 
-	return s.registry.Add(entry)
+	entry := entryFromManifest(manifest, "local")
+
+	if err := s.registry.Add(entry); err != nil {
+		return err
+	}
+	return s.writeLock()
+}
+
+// loadManifest loads and strictly validates the plugin.json in dir. name,
+// when set, is the directory the plugin is started from.
+func (s *PluginInstallerService) loadManifest(dir, name string) (*Manifest, error) {
+	manifest, issues := ValidateManifest(dir, name, s.rules)
+	if HasManifestErrors(issues) {
+		return nil, &ManifestError{Dir: dir, Issues: issues}
+	}
+	return manifest, nil
+}
+
+// approve asks for the capabilities of manifest unless the registered
+// plugin name was already granted all of them.
+func (s *PluginInstallerService) approve(name string, manifest *Manifest, approve Approver) error {
+	var granted *Capabilities
+	if entry, ok := s.registry.Find(name); ok && entry.Granted != nil {
+		granted = entry.Granted
+		if manifest.Capabilities.Missing(*granted).IsZero() {
+			return nil
+		}
+	}
+	if !approve(name, manifest.Capabilities, granted) {
+		return ErrNotGranted
+	}
+	return nil
 }
 
 func extractRepoName(url string) string {
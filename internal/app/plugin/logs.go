@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxLogSize is the size at which a plugin log is rotated to .log.1.
+	maxLogSize = 1 << 20
+	// errorTailLines is how many lines of plugin output wakeup errors show.
+	errorTailLines = 10
+)
+
+// DefaultLogsDir is where plugin output is kept:
+// $XDG_STATE_HOME/workforge/plugins, ~/.local/state by default.
+func DefaultLogsDir() string {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		home, _ := os.UserHomeDir()
+		stateDir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDir, "workforge", "plugins")
+}
+
+// SetLogsDir changes where plugin output is written.
+func (s *PluginService) SetLogsDir(dir string) {
+	s.logsDir = dir
+}
+
+// LogPath is the file a plugin's stdout and stderr are appended to.
+func (s *PluginService) LogPath(name string) string {
+	return filepath.Join(s.logsDir, name+".log")
+}
+
+// openLog opens the plugin log for appending, rotating it first when it
+// has grown past maxLogSize, and marks the start of a new run. It returns
+// the offset at which the new run's output begins.
+func (s *PluginService) openLog(name string) (*os.File, int64, error) {
+	if err := os.MkdirAll(s.logsDir, 0o755); err != nil {
+		return nil, 0, fmt.Errorf("create logs dir: %w", err)
+	}
+	path := s.LogPath(name)
+	if info, err := os.Stat(path); err == nil && info.Size() > maxLogSize {
+		os.Rename(path, path+".1")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open plugin log: %w", err)
+	}
+	fmt.Fprintf(f, "--- %s starting %s\n", time.Now().Format(time.RFC3339), name)
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, offset, nil
+}
+
+// logEvent appends a supervisor message to the plugin log.
+func (s *PluginService) logEvent(name, format string, args ...any) {
+	f, err := os.OpenFile(s.LogPath(name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "--- %s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+// outputSince formats the last lines the plugin wrote after offset for an
+// error message, or returns "" when it wrote nothing.
+func (s *PluginService) outputSince(name string, offset int64) string {
+	f, err := os.Open(s.LogPath(name))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return ""
+	}
+	lines := lastLines(f, errorTailLines)
+	if len(lines) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n  last output (%s):\n    %s", s.LogPath(name), strings.Join(lines, "\n    "))
+}
+
+// TailLog writes the last n lines of the log at path to w.
+func TailLog(path string, n int, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, line := range lastLines(f, n) {
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// FollowLog writes what is appended to the log at path to w until ctx is
+// done, reopening the file when it is rotated.
+func FollowLog(ctx context.Context, path string, w io.Writer) error {
+	var f *os.File
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	for {
+		info, err := os.Stat(path)
+		if err == nil && info.Size() < offset {
+			// Rotated: start over at the beginning of the new file.
+			if f != nil {
+				f.Close()
+				f = nil
+			}
+			offset = 0
+		}
+		if err == nil && f == nil {
+			if f, err = os.Open(path); err != nil {
+				return err
+			}
+			if _, err := f.Seek(offset, io.SeekStart); err != nil {
+				return err
+			}
+		}
+		if f != nil {
+			n, err := io.Copy(w, f)
+			if err != nil {
+				return err
+			}
+			offset += n
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+func lastLines(r io.Reader, n int) []string {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
@@ -1,18 +1,76 @@
 package plugin
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"workforge/internal/util"
 )
 
+// ManifestVersion is the plugin.json format this wf understands. Manifests
+// without manifest_version predate it and get defaults for entrypoint and
+// runtime.
+const ManifestVersion = 1
+
+const (
+	// ModeSync plugins are waited for and may answer pre-hooks.
+	ModeSync = "sync"
+	// ModeAsync plugins are notified without waiting for their reply.
+	ModeAsync = "async"
+)
+
+const (
+	// LifecycleDaemon plugins keep running until stopped with wf plugin kill.
+	LifecycleDaemon = "daemon"
+	// LifecycleOnDemand plugins are started when a hook needs them, shared
+	// by every wf process and stopped once idle for their idle_timeout.
+	LifecycleOnDemand = "on_demand"
+	// LifecyclePerCommand plugins are stopped when the wf command that
+	// started them exits.
+	LifecyclePerCommand = "per_command"
+)
+
+// DefaultIdleTimeout is how long an on_demand plugin may go unused.
+const DefaultIdleTimeout = 10 * time.Minute
+
 type Manifest struct {
-	Name       string   `json:"name"`
-	ConfigKey  string   `json:"config_key"`
-	Hooks      []string `json:"hooks"`
-	Entrypoint string   `json:"entrypoint"`
-	Runtime    string   `json:"runtime"`
+	ManifestVersion int             `json:"manifest_version,omitempty"`
+	Name            string          `json:"name"`
+	Version         string          `json:"version,omitempty"`
+	ConfigKey       string          `json:"config_key"`
+	ConfigSchema    json.RawMessage `json:"config_schema,omitempty"`
+	Hooks           []string        `json:"hooks"`
+	Entrypoint      string          `json:"entrypoint"`
+	Runtime         string          `json:"runtime"`
+	// Build is a shell command run in the plugin directory at install and
+	// update, e.g. "go build -o plugin .".
+	Build string `json:"build,omitempty"`
+	// Priority orders hook delivery: higher first, equal priorities
+	// concurrently.
+	Priority  int    `json:"priority,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	Lifecycle string `json:"lifecycle,omitempty"`
+	// IdleTimeout is a duration such as "30m"; on_demand plugins only.
+	IdleTimeout  string       `json:"idle_timeout,omitempty"`
+	Capabilities Capabilities `json:"capabilities,omitempty"`
+}
+
+// IdleAfter is how long an on_demand plugin may go unused before it is
+// stopped; zero for plugins that are never stopped for being idle.
+func (m *Manifest) IdleAfter() time.Duration {
+	if m.Lifecycle != LifecycleOnDemand {
+		return 0
+	}
+	if d, err := time.ParseDuration(m.IdleTimeout); err == nil && d > 0 {
+		return d
+	}
+	return DefaultIdleTimeout
 }
 
 func LoadManifest(pluginDir string) (*Manifest, error) {
@@ -26,13 +84,211 @@ func LoadManifest(pluginDir string) (*Manifest, error) {
 	if err := json.Unmarshal(data, &m); err != nil {
 		return nil, fmt.Errorf("parse manifest: %w", err)
 	}
+	if m.ManifestVersion > ManifestVersion {
+		return nil, fmt.Errorf("parse manifest: manifest_version %d needs a newer wf (supported: %d)", m.ManifestVersion, ManifestVersion)
+	}
 
-	if m.Entrypoint == "" {
-		m.Entrypoint = "main.py"
+	m.Hooks = union(m.Hooks, m.Capabilities.Hooks)
+	m.Capabilities.Hooks = m.Hooks
+
+	m.Runtime = normalizeRuntime(m.Runtime)
+	if m.ManifestVersion == 0 {
+		if m.Entrypoint == "" {
+			m.Entrypoint = "main.py"
+		}
+		if m.Runtime == "" {
+			m.Runtime = "python3"
+		}
 	}
-	if m.Runtime == "" {
-		m.Runtime = "python3"
+	switch m.Mode {
+	case "":
+		m.Mode = ModeSync
+	case ModeSync, ModeAsync:
+	default:
+		return nil, fmt.Errorf("parse manifest: unknown mode %q (want %s or %s)", m.Mode, ModeSync, ModeAsync)
+	}
+	switch m.Lifecycle {
+	case "":
+		m.Lifecycle = LifecycleOnDemand
+	case LifecycleDaemon, LifecycleOnDemand, LifecyclePerCommand:
+	default:
+		return nil, fmt.Errorf("parse manifest: unknown lifecycle %q (want %s, %s or %s)", m.Lifecycle, LifecycleDaemon, LifecycleOnDemand, LifecyclePerCommand)
+	}
+	if m.IdleTimeout != "" {
+		if d, err := time.ParseDuration(m.IdleTimeout); err != nil || d <= 0 {
+			return nil, fmt.Errorf("parse manifest: idle_timeout %q is not a positive duration such as \"30m\"", m.IdleTimeout)
+		}
 	}
 
 	return &m, nil
 }
+
+// ManifestRules are the names a manifest may refer to.
+type ManifestRules struct {
+	Hooks       []string
+	HostMethods []string
+}
+
+// ManifestIssue is a problem found in a plugin.json. Warnings do not stop
+// installation.
+type ManifestIssue struct {
+	Field   string
+	Message string
+	Warning bool
+}
+
+func (i ManifestIssue) String() string {
+	severity := "error"
+	if i.Warning {
+		severity = "warning"
+	}
+	return severity + ": " + i.text()
+}
+
+func (i ManifestIssue) text() string {
+	if i.Field == "" {
+		return i.Message
+	}
+	return i.Field + ": " + i.Message
+}
+
+// ManifestError reports the errors that make a plugin.json unusable.
+type ManifestError struct {
+	Dir    string
+	Issues []ManifestIssue
+}
+
+func (e *ManifestError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid plugin.json in %s", e.Dir)
+	for _, issue := range e.Issues {
+		if !issue.Warning {
+			fmt.Fprintf(&b, "\n  %s", issue.text())
+		}
+	}
+	return b.String()
+}
+
+var (
+	namePattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	configKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	envPattern       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ValidateManifest loads the plugin.json in dir and checks it strictly.
+// When name is not empty the manifest must use it, as the plugin is
+// started from the directory of that name. It returns the manifest, nil
+// when it cannot be loaded, and every issue found.
+func ValidateManifest(dir, name string, rules ManifestRules) (*Manifest, []ManifestIssue) {
+	var issues []ManifestIssue
+	add := func(warning bool, field, format string, args ...interface{}) {
+		issues = append(issues, ManifestIssue{Field: field, Message: fmt.Sprintf(format, args...), Warning: warning})
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "plugin.json"))
+	if err != nil {
+		add(false, "", "%v", err)
+		return nil, issues
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var strict Manifest
+	if err := dec.Decode(&strict); err != nil && strings.HasPrefix(err.Error(), "json: unknown field") {
+		add(false, "", "%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	m, err := LoadManifest(dir)
+	if err != nil {
+		add(false, "", "%s", strings.TrimPrefix(err.Error(), "parse manifest: "))
+		return nil, issues
+	}
+
+	if m.ManifestVersion == 0 {
+		add(true, "manifest_version", "missing; set it to %d (entrypoint and runtime then have no defaults)", ManifestVersion)
+	}
+
+	switch {
+	case m.Name == "":
+		add(false, "name", "required")
+	case !namePattern.MatchString(m.Name):
+		add(false, "name", "%q may only contain letters, digits, '.', '_' and '-'", m.Name)
+	case name != "" && m.Name != name:
+		add(false, "name", "%q does not match the plugin directory %q; rename one of them", m.Name, name)
+	}
+
+	if m.ConfigKey != "" && !configKeyPattern.MatchString(m.ConfigKey) {
+		add(false, "config_key", "%q is not a valid .wfconfig.yml key", m.ConfigKey)
+	}
+	if len(m.ConfigSchema) > 0 && bytes.TrimSpace(m.ConfigSchema)[0] != '{' {
+		add(false, "config_schema", "must be a JSON Schema object")
+	}
+
+	if len(m.Hooks) == 0 {
+		add(false, "hooks", "required; list the hooks the plugin handles")
+	}
+	for _, h := range m.Hooks {
+		if !contains(rules.Hooks, h) {
+			add(false, "hooks", "%s", unknownName("hook", h, rules.Hooks))
+		}
+	}
+
+	if m.Entrypoint == "" {
+		add(false, "entrypoint", "required")
+	} else if filepath.IsAbs(m.Entrypoint) || strings.HasPrefix(filepath.Clean(m.Entrypoint), "..") {
+		add(false, "entrypoint", "%q must be a path inside the plugin directory", m.Entrypoint)
+	} else if m.Build == "" {
+		// With a build step the entrypoint may not exist until it runs.
+		info, err := os.Stat(filepath.Join(dir, m.Entrypoint))
+		switch {
+		case err != nil:
+			add(false, "entrypoint", "%q not found in %s", m.Entrypoint, dir)
+		case info.IsDir() && m.Runtime != RuntimeGo:
+			add(false, "entrypoint", "%q is a directory", m.Entrypoint)
+		case m.Runtime == RuntimeBinary && info.Mode().Perm()&0o111 == 0:
+			add(false, "entrypoint", "%q is not executable", m.Entrypoint)
+		}
+	}
+	switch m.Runtime {
+	case "":
+		add(false, "runtime", "required")
+	case RuntimeBinary:
+	default:
+		if err := checkRuntime(m.Runtime); err != nil {
+			add(true, "runtime", "%v", err)
+		}
+	}
+
+	if m.IdleTimeout != "" && m.Lifecycle != LifecycleOnDemand {
+		add(true, "idle_timeout", "ignored for lifecycle %s", m.Lifecycle)
+	}
+
+	for _, method := range m.Capabilities.Host {
+		if !contains(rules.HostMethods, method) {
+			add(false, "capabilities.host", "%s", unknownName("host method", method, rules.HostMethods))
+		}
+	}
+	for _, env := range m.Capabilities.Env {
+		if env != "*" && !envPattern.MatchString(env) {
+			add(false, "capabilities.env", "%q is not an environment variable name", env)
+		}
+	}
+
+	return m, issues
+}
+
+func unknownName(kind, name string, known []string) string {
+	if suggestion := util.Closest(name, known); suggestion != "" {
+		return fmt.Sprintf("unknown %s %q (did you mean %q?)", kind, name, suggestion)
+	}
+	return fmt.Sprintf("unknown %s %q", kind, name)
+}
+
+// HasManifestErrors reports whether issues contains an error.
+func HasManifestErrors(issues []ManifestIssue) bool {
+	for _, issue := range issues {
+		if !issue.Warning {
+			return true
+		}
+	}
+	return false
+}
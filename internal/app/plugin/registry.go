@@ -7,12 +7,47 @@ import (
 )
 
 type PluginEntry struct {
-	Name       string   `json:"name"`
-	URL        string   `json:"url"`
-	ConfigKey  string   `json:"config_key"`
-	Hooks      []string `json:"hooks"`
-	Entrypoint string   `json:"entrypoint"`
-	Runtime    string   `json:"runtime"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	URL     string `json:"url"`
+	// Source is one of SourceGit, SourcePath, SourceLink or SourceArchive;
+	// empty for plugins installed before it was recorded.
+	Source string `json:"source,omitempty"`
+	// Checksum is the sha256 of the archive a plugin was installed from.
+	Checksum string `json:"checksum,omitempty"`
+	// Ref is the tag or commit the plugin is pinned to; empty follows the
+	// default branch.
+	Ref          string          `json:"ref,omitempty"`
+	Commit       string          `json:"commit,omitempty"`
+	ConfigKey    string          `json:"config_key"`
+	ConfigSchema json.RawMessage `json:"config_schema,omitempty"`
+	Hooks        []string        `json:"hooks"`
+	Entrypoint   string          `json:"entrypoint"`
+	Runtime      string          `json:"runtime"`
+	Priority     int             `json:"priority,omitempty"`
+	Mode         string          `json:"mode,omitempty"`
+	// Granted is what the user approved; nil for plugins registered
+	// before capabilities existed.
+	Granted *Capabilities `json:"granted,omitempty"`
+}
+
+// entryFromManifest builds the registry entry for a plugin installed from
+// url with the capabilities it requests granted.
+func entryFromManifest(m *Manifest, url string) PluginEntry {
+	granted := m.Capabilities
+	return PluginEntry{
+		Name:         m.Name,
+		Version:      m.Version,
+		URL:          url,
+		ConfigKey:    m.ConfigKey,
+		ConfigSchema: m.ConfigSchema,
+		Hooks:        m.Hooks,
+		Entrypoint:   m.Entrypoint,
+		Runtime:      m.Runtime,
+		Priority:     m.Priority,
+		Mode:         m.Mode,
+		Granted:      &granted,
+	}
 }
 
 type Registry struct {
@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Runtimes with dedicated handling. Any other runtime names an interpreter
+// that is run with the entrypoint as its first argument.
+const (
+	// RuntimeBinary executes the entrypoint directly.
+	RuntimeBinary = "binary"
+	RuntimeNode   = "node"
+	RuntimeDeno   = "deno"
+	// RuntimeGo runs the entrypoint, a file or package directory, with
+	// go run.
+	RuntimeGo = "go"
+)
+
+const (
+	startTimeout = 5 * time.Second
+	// goStartTimeout leaves go run time to compile the plugin.
+	goStartTimeout = 60 * time.Second
+)
+
+// runtimeEnv lists the variables a runtime needs besides the base set.
+var runtimeEnv = map[string][]string{
+	RuntimeGo:   {"GOPATH", "GOROOT", "GOCACHE", "GOMODCACHE", "GOFLAGS", "GOPROXY", "GOPRIVATE", "GONOSUMDB", "GOTOOLCHAIN"},
+	RuntimeNode: {"NODE_PATH", "NODE_OPTIONS"},
+	RuntimeDeno: {"DENO_DIR"},
+}
+
+// normalizeRuntime maps spellings like "go run" to the runtime constants.
+func normalizeRuntime(runtime string) string {
+	switch strings.Join(strings.Fields(runtime), " ") {
+	case "go run", "go":
+		return RuntimeGo
+	case "nodejs":
+		return RuntimeNode
+	}
+	return runtime
+}
+
+// runtimeCommand returns the program and arguments that start the plugin
+// in dir. args are passed to the plugin itself.
+func runtimeCommand(m *Manifest, dir string, granted Capabilities, args []string) (string, []string, error) {
+	entrypoint := filepath.Join(dir, m.Entrypoint)
+	var program string
+	var argv []string
+	switch m.Runtime {
+	case RuntimeBinary:
+		info, err := os.Stat(entrypoint)
+		if err != nil {
+			return "", nil, fmt.Errorf("plugin binary %s not found; was its build step run?", entrypoint)
+		}
+		if info.IsDir() || info.Mode().Perm()&0o111 == 0 {
+			return "", nil, fmt.Errorf("plugin binary %s is not executable", entrypoint)
+		}
+		return entrypoint, args, nil
+	case RuntimeGo:
+		program = "go"
+		argv = []string{"run", entrypoint}
+	case RuntimeDeno:
+		program = "deno"
+		argv = []string{"run", "--allow-read", "--allow-write", "--allow-env"}
+		if granted.Network {
+			argv = append(argv, "--allow-net")
+		}
+		argv = append(argv, entrypoint)
+	default:
+		program = m.Runtime
+		argv = []string{entrypoint}
+	}
+	if _, err := os.Stat(entrypoint); err != nil {
+		return "", nil, fmt.Errorf("entrypoint %s not found", entrypoint)
+	}
+	if err := checkRuntime(program); err != nil {
+		return "", nil, err
+	}
+	return program, append(argv, args...), nil
+}
+
+// checkRuntime fails with a clear message when program is not on PATH.
+func checkRuntime(program string) error {
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("runtime %q not found on PATH; install it or change \"runtime\" in plugin.json", program)
+	}
+	return nil
+}
+
+// RuntimeStartTimeout is how long Wakeup waits for a plugin of runtime to
+// open its socket.
+func RuntimeStartTimeout(runtime string) time.Duration {
+	if runtime == RuntimeGo {
+		return goStartTimeout
+	}
+	return startTimeout
+}
+
+// build runs the manifest's build step in dir, e.g. go build -o plugin.
+// What it prints goes to the writer set with SetBuildOutput; without one
+// it is only shown in the error when the build fails.
+func (s *PluginInstallerService) build(m *Manifest, dir string) error {
+	if m.Build == "" {
+		return nil
+	}
+	var captured bytes.Buffer
+	out := s.buildOutput
+	if out == nil {
+		out = &captured
+	} else {
+		fmt.Fprintf(out, "Building plugin %s: %s\n", m.Name, m.Build)
+	}
+	cmd := exec.Command("sh", "-c", m.Build)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(captured.String()); output != "" {
+			return fmt.Errorf("build step %q failed: %w\n%s", m.Build, err, output)
+		}
+		return fmt.Errorf("build step %q failed: %w", m.Build, err)
+	}
+	return nil
+}
+
+// killProcess kills p, with its process group when group is set.
+func killProcess(p *os.Process, group bool) {
+	if group {
+		syscall.Kill(-p.Pid, syscall.SIGKILL)
+		return
+	}
+	p.Kill()
+}
@@ -0,0 +1,409 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Scaffold languages for `wf plugin new`.
+const (
+	LangPython = "python"
+	LangGo     = "go"
+)
+
+// ScaffoldLangs lists the languages Scaffold supports.
+var ScaffoldLangs = []string{LangPython, LangGo}
+
+type scaffoldData struct {
+	Name      string
+	ConfigKey string
+	Hooks     []string
+	Lang      string
+}
+
+type scaffoldFile struct {
+	name string
+	tmpl string
+	mode os.FileMode
+}
+
+var scaffoldFiles = map[string][]scaffoldFile{
+	LangPython: {
+		{"main.py", pythonMain, 0o755},
+		{"README.md", scaffoldReadme, 0o644},
+	},
+	LangGo: {
+		{"main.go", goMain, 0o644},
+		{"go.mod", goMod, 0o644},
+		{".gitignore", goGitignore, 0o644},
+		{"README.md", scaffoldReadme, 0o644},
+	},
+}
+
+// Scaffold writes a new plugin named name into dir: plugin.json, an
+// entrypoint implementing the socket protocol with a handler per hook, and
+// a README. dir must not exist yet and hooks must be known to rules.
+func Scaffold(dir, name, lang string, hooks []string, rules ManifestRules) error {
+	files, ok := scaffoldFiles[lang]
+	if !ok {
+		return fmt.Errorf("unknown language %q (available: %s)", lang, strings.Join(ScaffoldLangs, ", "))
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid plugin name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	if len(hooks) == 0 {
+		return fmt.Errorf("at least one hook is required")
+	}
+	for _, h := range hooks {
+		if !contains(rules.Hooks, h) {
+			return fmt.Errorf("%s", unknownName("hook", h, rules.Hooks))
+		}
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists", dir)
+	}
+
+	data := scaffoldData{
+		Name:      name,
+		ConfigKey: strings.NewReplacer("-", "_", ".", "_").Replace(name),
+		Hooks:     append([]string(nil), hooks...),
+		Lang:      lang,
+	}
+	sort.Strings(data.Hooks)
+
+	manifest := Manifest{
+		ManifestVersion: ManifestVersion,
+		Name:            name,
+		Version:         "0.1.0",
+		ConfigKey:       data.ConfigKey,
+		Hooks:           data.Hooks,
+	}
+	switch lang {
+	case LangPython:
+		manifest.Runtime = "python3"
+		manifest.Entrypoint = "main.py"
+	case LangGo:
+		manifest.Runtime = RuntimeBinary
+		manifest.Entrypoint = name
+		manifest.Build = "go build -o " + name + " ."
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "plugin.json"), append(encoded, '\n'), 0o644); err != nil {
+		return err
+	}
+	for _, f := range files {
+		tmpl, err := template.New(f.name).Parse(f.tmpl)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return err
+		}
+		content := []byte(strings.TrimLeft(b.String(), "\n"))
+		if strings.HasSuffix(f.name, ".go") {
+			if content, err = format.Source(content); err != nil {
+				return fmt.Errorf("format %s: %w", f.name, err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.name), content, f.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const pythonMain = `
+#!/usr/bin/env python3
+"""{{.Name}}: a workforge plugin.
+
+workforge starts this script with the socket to listen on as the first
+argument and sends newline-delimited JSON-RPC 2.0 requests. Requests
+without an "id" are notifications and get no answer; several requests may
+arrive at once as a batch array.
+"""
+import json
+import os
+import socket
+import sys
+import threading
+
+
+def log(msg):
+    print("[{{.Name}}] " + msg, file=sys.stderr, flush=True)
+
+{{range .Hooks}}
+def {{.}}(payload):
+    # payload: {"project", "hook_type", "data", "config"}
+    return None
+{{end}}
+
+HANDLERS = {
+{{- range .Hooks}}
+    "{{.}}": {{.}},
+{{- end}}
+}
+
+
+def handle(req):
+    method = req.get("method")
+    if method == "on_ping":
+        result = "pong"
+    elif method in HANDLERS:
+        try:
+            result = HANDLERS[method](req.get("params") or {})
+        except Exception as e:
+            log("%s failed: %s" % (method, e))
+            if "id" not in req:
+                return None
+            return {"jsonrpc": "2.0", "id": req["id"], "error": {"code": -32603, "message": str(e)}}
+    else:
+        if "id" not in req:
+            return None
+        return {"jsonrpc": "2.0", "id": req["id"], "error": {"code": -32601, "message": "unknown method %s" % method}}
+    if "id" not in req:
+        return None
+    return {"jsonrpc": "2.0", "id": req["id"], "result": result}
+
+
+def serve(conn, path):
+    lock = threading.Lock()
+    f = conn.makefile("rb")
+
+    def send(msg):
+        with lock:
+            conn.sendall((json.dumps(msg) + "\n").encode())
+
+    for line in f:
+        if not line.strip():
+            continue
+        msg = json.loads(line)
+        if isinstance(msg, dict) and msg.get("method") == "shutdown":
+            log("shutdown requested")
+            try:
+                if "id" in msg:
+                    send({"jsonrpc": "2.0", "id": msg["id"], "result": None})
+                os.remove(path)
+            except OSError:
+                pass
+            os._exit(0)
+        if isinstance(msg, list):
+            replies = [r for r in map(handle, msg) if r]
+            if replies:
+                send(replies)
+        else:
+            reply = handle(msg)
+            if reply:
+                send(reply)
+    conn.close()
+
+
+def main():
+    path = sys.argv[1]
+    if os.path.exists(path):
+        os.remove(path)
+    srv = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    srv.bind(path)
+    srv.listen(16)
+    log("listening on " + path)
+    while True:
+        conn, _ = srv.accept()
+        threading.Thread(target=serve, args=(conn, path), daemon=True).start()
+
+
+if __name__ == "__main__":
+    main()
+`
+
+const goMain = `
+// Command {{.Name}} is a workforge plugin.
+//
+// workforge starts it with the socket to listen on as the first argument
+// and sends newline-delimited JSON-RPC 2.0 requests. Requests without an
+// id are notifications and get no answer; several requests may arrive at
+// once as a batch array.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"sync"
+)
+
+// Payload is what workforge sends with every hook.
+type Payload struct {
+	Project  string          ` + "`json:\"project\"`" + `
+	HookType string          ` + "`json:\"hook_type\"`" + `
+	Data     map[string]any  ` + "`json:\"data,omitempty\"`" + `
+	Config   json.RawMessage ` + "`json:\"config,omitempty\"`" + `
+}
+
+// handlers answer hooks. A nil result answers null; a string is printed
+// by workforge; pre-hooks may return {"action": "abort", "reason": ...}.
+var handlers = map[string]func(Payload) (any, error){
+{{- range .Hooks}}
+	"{{.}}": func(p Payload) (any, error) { return nil, nil },
+{{- end}}
+}
+
+type request struct {
+	ID     json.RawMessage ` + "`json:\"id,omitempty\"`" + `
+	Method string          ` + "`json:\"method\"`" + `
+	Params json.RawMessage ` + "`json:\"params,omitempty\"`" + `
+}
+
+type rpcError struct {
+	Code    int    ` + "`json:\"code\"`" + `
+	Message string ` + "`json:\"message\"`" + `
+}
+
+type response struct {
+	JSONRPC string          ` + "`json:\"jsonrpc\"`" + `
+	ID      json.RawMessage ` + "`json:\"id\"`" + `
+	Result  any             ` + "`json:\"result,omitempty\"`" + `
+	Error   *rpcError       ` + "`json:\"error,omitempty\"`" + `
+}
+
+var logger = log.New(os.Stderr, "[{{.Name}}] ", log.LstdFlags)
+
+func main() {
+	if len(os.Args) < 2 {
+		logger.Fatal("usage: {{.Name}} <socket>")
+	}
+	path := os.Args[1]
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Printf("listening on %s", path)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			logger.Fatal(err)
+		}
+		go serve(conn, path)
+	}
+}
+
+func serve(conn net.Conn, path string) {
+	defer conn.Close()
+	var mu sync.Mutex
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		mu.Lock()
+		defer mu.Unlock()
+		conn.Write(append(data, '\n'))
+	}
+	dec := json.NewDecoder(conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+			var batch []request
+			if json.Unmarshal(raw, &batch) != nil {
+				continue
+			}
+			var out []response
+			for _, req := range batch {
+				if resp, ok := handle(req); ok {
+					out = append(out, resp)
+				}
+			}
+			if len(out) > 0 {
+				send(out)
+			}
+			continue
+		}
+		var req request
+		if json.Unmarshal(raw, &req) != nil {
+			continue
+		}
+		if req.Method == "shutdown" {
+			logger.Print("shutdown requested")
+			if len(req.ID) > 0 {
+				send(response{JSONRPC: "2.0", ID: req.ID})
+			}
+			os.Remove(path)
+			os.Exit(0)
+		}
+		if resp, ok := handle(req); ok {
+			send(resp)
+		}
+	}
+}
+
+// handle answers req; it reports false for notifications.
+func handle(req request) (response, bool) {
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == "on_ping" {
+		resp.Result = "pong"
+	} else if h, ok := handlers[req.Method]; !ok {
+		resp.Error = &rpcError{Code: -32601, Message: "unknown method " + req.Method}
+	} else {
+		var p Payload
+		json.Unmarshal(req.Params, &p)
+		result, err := h(p)
+		if err != nil {
+			logger.Printf("%s: %v", req.Method, err)
+			resp.Error = &rpcError{Code: -32603, Message: err.Error()}
+		} else {
+			resp.Result = result
+		}
+	}
+	return resp, len(req.ID) > 0 && string(req.ID) != "null"
+}
+`
+
+const goMod = `
+module {{.Name}}
+
+go 1.22
+`
+
+const goGitignore = `
+/{{.Name}}
+`
+
+const scaffoldReadme = `
+# {{.Name}}
+
+A [workforge](https://github.com/) plugin handling {{range $i, $h := .Hooks}}{{if $i}}, {{end}}` + "`{{$h}}`" + `{{end}}.
+
+## Develop
+
+` + "```sh" + `
+wf plugin validate .     # check plugin.json
+wf plugin test .         # start the plugin and send it every hook
+wf plugin add . --link   # install it, picking up edits on the next start
+` + "```" + `
+
+Each hook handler receives the payload workforge sends:
+
+` + "```json" + `
+{"project": "myapp", "hook_type": "on_load", "data": {}, "config": {}}
+` + "```" + `
+
+` + "`config`" + ` is the ` + "`{{.ConfigKey}}`" + ` section of the project's .wfconfig.yml. A handler
+may return nothing, a message string, or for pre-hooks an object such as
+` + "`{\"action\": \"abort\", \"reason\": \"...\"}`" + `. Anything written to stderr ends up in
+the plugin log.
+`
@@ -2,12 +2,14 @@ package plugin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -34,21 +36,58 @@ type PluginInfo struct {
 	Name       string
 	SocketPath string
 	Process    *os.Process
+
+	conn *rpcConn
+	// group is set when Process leads its own process group.
+	group bool
+	// legacy is set for plugins whose manifest has no manifest_version.
+	// They were written for one request per connection: each request gets
+	// a connection of its own and none is sent as a batch or notification.
+	legacy bool
+
+	// exited is closed by the supervisor once Process has been reaped;
+	// nil for plugins started by another wf process.
+	exited   chan struct{}
+	exitErr  error
+	started  time.Time
+	restarts int
+
+	lifecycle string
+	// idleAfter is how long the plugin may go unused before idle stops it;
+	// zero when it is never stopped for being idle.
+	idleAfter time.Duration
+	idle      *time.Timer
+	// stopping is set under mu before the plugin is stopped on purpose,
+	// so its exit is not treated as a crash.
+	stopping bool
 }
 
 type PluginService struct {
 	pluginsDir string
 	socketsDir string
+	logsDir    string
+	registry   *PluginRegistryService
 	plugins    map[string]*PluginInfo
 	mu         sync.RWMutex
 	requestID  int
+
+	// starting serializes Wakeup per plugin, so different plugins can start
+	// concurrently.
+	starting map[string]*sync.Mutex
+
+	hostMethods map[string]HostMethod
+	hosts       map[string]*hostServer
 }
 
-func NewPluginService(pluginsDir, socketsDir string) *PluginService {
+func NewPluginService(pluginsDir, socketsDir string, registry *PluginRegistryService) *PluginService {
 	return &PluginService{
 		pluginsDir: pluginsDir,
 		socketsDir: socketsDir,
+		logsDir:    DefaultLogsDir(),
+		registry:   registry,
 		plugins:    make(map[string]*PluginInfo),
+		starting:   make(map[string]*sync.Mutex),
+		hosts:      make(map[string]*hostServer),
 	}
 }
 
@@ -57,136 +96,421 @@ func DefaultPluginsDir() string {
 	return filepath.Join(configDir, "workforge", "plugins")
 }
 
+// DefaultSocketsDir is where plugin sockets, pidfiles and locks live:
+// under $XDG_RUNTIME_DIR, or a per-user dir in the temp dir without it.
 func DefaultSocketsDir() string {
-	return filepath.Join(os.TempDir(), "workforge-plugins")
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "workforge-plugins")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("workforge-plugins-%d", os.Getuid()))
 }
 
-func (s *PluginService) Wakeup(name string) error {
+func (s *PluginService) startLock(name string) *sync.Mutex {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	lock, ok := s.starting[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.starting[name] = lock
+	}
+	return lock
+}
+
+func (s *PluginService) Wakeup(name string) error {
+	lock := s.startLock(name)
+	lock.Lock()
+	defer lock.Unlock()
 
 	socketPath := filepath.Join(s.socketsDir, name+".sock")
 
-	if info, exists := s.plugins[name]; exists {
+	s.mu.RLock()
+	info, exists := s.plugins[name]
+	s.mu.RUnlock()
+	if exists {
 		if s.isAlive(info) {
 			return nil
 		}
+		s.mu.Lock()
 		delete(s.plugins, name)
+		s.mu.Unlock()
+	}
+
+	pluginDir := filepath.Join(s.pluginsDir, name)
+
+	unlock, err := s.lockStart(name)
+	if err != nil {
+		return fmt.Errorf("lock plugin %q: %w", name, err)
 	}
+	defer unlock()
 
 	if s.isSocketAlive(socketPath) {
-		s.plugins[name] = &PluginInfo{
+		// Started by another wf process.
+		adopted := &PluginInfo{
 			Name:       name,
 			SocketPath: socketPath,
 			Process:    nil,
 		}
+		if rec, _, err := s.readPid(name); err == nil {
+			adopted.lifecycle = rec.Lifecycle
+			adopted.idleAfter = rec.idleAfter()
+		}
+		if manifest, err := LoadManifest(pluginDir); err == nil {
+			adopted.legacy = manifest.ManifestVersion == 0
+		}
+		s.mu.Lock()
+		s.plugins[name] = adopted
+		s.mu.Unlock()
+		s.serveHost(name, s.grantedFor(name).Host)
 		return nil
 	}
 
-	pluginDir := filepath.Join(s.pluginsDir, name)
 	manifest, err := LoadManifest(pluginDir)
 	if err != nil {
 		return fmt.Errorf("load plugin manifest: %w", err)
 	}
 
-	entrypoint := filepath.Join(pluginDir, manifest.Entrypoint)
-	if _, err := os.Stat(entrypoint); err != nil {
-		return fmt.Errorf("plugin %q not found: %w", name, err)
+	info, err = s.start(name, manifest)
+	if err != nil {
+		return err
 	}
+	s.mu.Lock()
+	s.plugins[name] = info
+	s.mu.Unlock()
 
-	if err := os.MkdirAll(s.socketsDir, 0o755); err != nil {
-		return fmt.Errorf("create sockets dir: %w", err)
-	}
+	return nil
+}
 
+// start spawns the plugin process with its output appended to the plugin
+// log and waits for it to open its socket. A supervisor goroutine reaps
+// the process and restarts it if it exits on its own.
+func (s *PluginService) start(name string, manifest *Manifest) (*PluginInfo, error) {
+	pluginDir := filepath.Join(s.pluginsDir, name)
+	socketPath := filepath.Join(s.socketsDir, name+".sock")
 	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("cleanup old socket: %w", err)
+		return nil, fmt.Errorf("cleanup old socket: %w", err)
 	}
 
-	cmd := exec.Command(manifest.Runtime, entrypoint, socketPath)
+	granted := s.grantedFor(name)
+	args := []string{socketPath}
+	if len(granted.Host) > 0 {
+		args = append(args, s.hostSocketPath(name))
+	}
+	program, argv, err := runtimeCommand(manifest, pluginDir, granted, args)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %q: %w", name, err)
+	}
+	if len(granted.Host) > 0 {
+		if err := s.serveHost(name, granted.Host); err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", name, err)
+		}
+	}
+	cmd := exec.Command(program, argv...)
 	cmd.Dir = pluginDir
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("start plugin %q: %w", name, err)
+	cmd.Env = append(pluginEnv(os.Environ(), manifest.Runtime, granted.Env), HostSocketEnv+"="+s.hostSocketPath(name))
+	// go run starts the compiled plugin as a child; a process group lets
+	// Kill stop both. Plugins that outlive this wf get their own session,
+	// away from the terminal's signals.
+	group := manifest.Runtime == RuntimeGo || manifest.Lifecycle != LifecyclePerCommand
+	switch {
+	case manifest.Lifecycle != LifecyclePerCommand:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	case group:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	}
 
-	if err := s.waitForSocket(socketPath, 5*time.Second); err != nil {
-		cmd.Process.Kill()
-		return fmt.Errorf("plugin %q failed to start: %w", name, err)
+	logFile, offset, err := s.openLog(name)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %q: %w", name, err)
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	err = cmd.Start()
+	logFile.Close()
+	if err != nil {
+		return nil, fmt.Errorf("start plugin %q: %w", name, err)
 	}
 
-	s.plugins[name] = &PluginInfo{
+	info := &PluginInfo{
 		Name:       name,
 		SocketPath: socketPath,
 		Process:    cmd.Process,
+		group:      group,
+		exited:     make(chan struct{}),
+		started:    time.Now(),
+		lifecycle:  manifest.Lifecycle,
+		idleAfter:  manifest.IdleAfter(),
+		legacy:     manifest.ManifestVersion == 0,
 	}
+	go s.supervise(info, cmd, manifest)
 
-	return nil
+	if err := s.waitForSocket(socketPath, RuntimeStartTimeout(manifest.Runtime), info.exited); err != nil {
+		if errors.Is(err, errExited) {
+			err = fmt.Errorf("exited (%s) before opening its socket", exitStatus(info.exitErr))
+		}
+		s.mu.Lock()
+		info.stopping = true
+		s.mu.Unlock()
+		killProcess(cmd.Process, group)
+		<-info.exited
+		return nil, fmt.Errorf("plugin %q failed to start: %w%s", name, err, s.outputSince(name, offset))
+	}
+	if err := s.writePid(name, info); err != nil {
+		s.logEvent(name, "write pidfile: %v", err)
+	}
+	return info, nil
 }
 
-func (s *PluginService) Call(name, method string, params interface{}) (json.RawMessage, error) {
-	s.mu.RLock()
-	info, exists := s.plugins[name]
-	s.mu.RUnlock()
+func (s *PluginService) newRequest(method string, params interface{}) Request {
+	s.mu.Lock()
+	s.requestID++
+	reqID := s.requestID
+	s.mu.Unlock()
+	return Request{JSONRPC: "2.0", ID: reqID, Method: method, Params: params}
+}
 
+// connection returns the persistent connection to a running plugin,
+// dialing a new one when there is none or the plugin closed it. A legacy
+// plugin gets a new connection, marked single, every time.
+func (s *PluginService) connection(name string) (*rpcConn, error) {
+	s.mu.Lock()
+	info, exists := s.plugins[name]
 	if !exists {
+		s.mu.Unlock()
 		return nil, fmt.Errorf("plugin %q not running", name)
 	}
+	s.touch(info)
+	if info.legacy {
+		s.mu.Unlock()
+		conn, err := dialRPC(info.SocketPath)
+		if err != nil {
+			return nil, fmt.Errorf("connect to plugin %q: %w", name, err)
+		}
+		conn.single = true
+		return conn, nil
+	}
+	if info.conn != nil && !info.conn.isClosed() {
+		conn := info.conn
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
 
-	conn, err := net.DialTimeout("unix", info.SocketPath, 5*time.Second)
+	conn, err := dialRPC(info.SocketPath)
 	if err != nil {
 		return nil, fmt.Errorf("connect to plugin %q: %w", name, err)
 	}
-	defer conn.Close()
 
 	s.mu.Lock()
-	s.requestID++
-	reqID := s.requestID
-	s.mu.Unlock()
-
-	req := Request{
-		JSONRPC: "2.0",
-		ID:      reqID,
-		Method:  method,
-		Params:  params,
+	defer s.mu.Unlock()
+	// Another caller may have connected while we were dialing.
+	if info.conn != nil && !info.conn.isClosed() {
+		conn.close()
+		return info.conn, nil
 	}
+	info.conn = conn
+	return conn, nil
+}
 
-	conn.SetDeadline(time.Now().Add(30 * time.Second))
-
-	if err := json.NewEncoder(conn).Encode(req); err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+// withConn runs fn on the plugin's connection, once more on a fresh one if
+// the request could not be sent. A request the plugin may already have
+// received is never sent twice.
+func (s *PluginService) withConn(name string, fn func(*rpcConn) error) error {
+	for attempt := 0; ; attempt++ {
+		conn, err := s.connection(name)
+		if err != nil {
+			return err
+		}
+		err = fn(conn)
+		if conn.single {
+			conn.close()
+		}
+		if errors.Is(err, errNotSent) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("plugin %q: %w", name, err)
+		}
+		return nil
 	}
+}
 
+func (s *PluginService) Call(name, method string, params interface{}) (json.RawMessage, error) {
+	req := s.newRequest(method, params)
 	var resp Response
-	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
-		return nil, fmt.Errorf("read response: %w", err)
+	err := s.withConn(name, func(conn *rpcConn) (err error) {
+		resp, err = conn.call(req)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-
 	if resp.Error != nil {
 		return nil, fmt.Errorf("plugin error [%d]: %s", resp.Error.Code, resp.Error.Message)
 	}
-
 	return resp.Result, nil
 }
 
+type BatchCall struct {
+	Method string
+	Params interface{}
+}
+
+type BatchResult struct {
+	Result json.RawMessage
+	Error  error
+}
+
+// CallBatch sends calls as one JSON-RPC batch and returns their results in
+// the same order. A legacy plugin gets them one at a time instead.
+func (s *PluginService) CallBatch(name string, calls []BatchCall) ([]BatchResult, error) {
+	if s.isLegacy(name) {
+		results := make([]BatchResult, len(calls))
+		for i, c := range calls {
+			results[i].Result, results[i].Error = s.Call(name, c.Method, c.Params)
+		}
+		return results, nil
+	}
+	reqs := make([]Request, len(calls))
+	for i, c := range calls {
+		reqs[i] = s.newRequest(c.Method, c.Params)
+	}
+	var responses []Response
+	err := s.withConn(name, func(conn *rpcConn) (err error) {
+		responses, err = conn.batch(reqs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BatchResult, len(responses))
+	for i, resp := range responses {
+		if resp.Error != nil {
+			results[i].Error = fmt.Errorf("plugin error [%d]: %s", resp.Error.Code, resp.Error.Message)
+			continue
+		}
+		results[i].Result = resp.Result
+	}
+	return results, nil
+}
+
+// Notify sends JSON-RPC notifications, as one batch when there are several.
+// The plugin does not answer them. A legacy plugin, which expects every
+// message to be a request, gets them as calls whose replies are ignored.
+func (s *PluginService) Notify(name string, notes ...Notification) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	if s.isLegacy(name) {
+		for _, note := range notes {
+			if _, err := s.Call(name, note.Method, note.Params); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	conn, err := s.connection(name)
+	if err != nil {
+		return err
+	}
+	if err := conn.notify(notes); err != nil {
+		return fmt.Errorf("plugin %q: %w", name, err)
+	}
+	return nil
+}
+
+func (s *PluginService) isLegacy(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.plugins[name]
+	return ok && info.legacy
+}
+
+// Kill stops a plugin, whichever wf process started it.
 func (s *PluginService) Kill(name string) error {
+	unlock, err := s.lockStart(name)
+	if err != nil {
+		return fmt.Errorf("lock plugin %q: %w", name, err)
+	}
+	defer unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.plugins[name]
+	if !exists || info.Process == nil {
+		if exists {
+			if info.conn != nil {
+				info.conn.close()
+			}
+			s.release(name, info)
+		}
+		return s.stopRecorded(name, recordedStopTimeout)
+	}
+
+	info.stopping = true
+	if info.conn != nil {
+		info.conn.close()
+	}
+	s.callShutdown(info)
+
+	if info.Process != nil {
+		killProcess(info.Process, info.group)
+		<-info.exited
+	}
+
+	s.release(name, info)
+	return nil
+}
+
+// Stop asks a running plugin to shut down and waits up to timeout for it
+// to exit before killing it. It reports whether the plugin exited on its
+// own.
+func (s *PluginService) Stop(name string, timeout time.Duration) (bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	info, exists := s.plugins[name]
 	if !exists {
-		return nil
+		return false, fmt.Errorf("plugin %s is not running", name)
 	}
 
+	info.stopping = true
+	if info.conn != nil {
+		info.conn.close()
+	}
 	s.callShutdown(info)
 
+	exited := true
 	if info.Process != nil {
-		info.Process.Kill()
-		info.Process.Wait()
+		select {
+		case <-info.exited:
+		case <-time.After(timeout):
+			exited = false
+			killProcess(info.Process, info.group)
+			<-info.exited
+		}
 	}
 
-	os.Remove(info.SocketPath)
-	delete(s.plugins, name)
+	s.release(name, info)
+	return exited, nil
+}
 
-	return nil
+// release forgets a stopped plugin and removes its sockets and pidfile. The
+// socket of a plugin started by another wf process is left alone.
+func (s *PluginService) release(name string, info *PluginInfo) {
+	if info.idle != nil {
+		info.idle.Stop()
+	}
+	if info.Process != nil {
+		os.Remove(info.SocketPath)
+		s.removePid(name, info.Process.Pid)
+	}
+	delete(s.plugins, name)
+	if host, ok := s.hosts[name]; ok {
+		host.listener.Close()
+		os.Remove(host.path)
+		delete(s.hosts, name)
+	}
 }
 
 func (s *PluginService) KillAll() {
@@ -220,15 +544,16 @@ func (s *PluginService) WakeupAsync(name string) <-chan WakeupResult {
 	return ch
 }
 
+// IsRunning reports whether a plugin is running, whichever wf process
+// started it.
 func (s *PluginService) IsRunning(name string) bool {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	info, exists := s.plugins[name]
-	if !exists {
-		return false
+	s.mu.RUnlock()
+	if exists {
+		return s.isAlive(info)
 	}
-	return s.isAlive(info)
+	return s.isSocketAlive(filepath.Join(s.socketsDir, name+".sock"))
 }
 
 func (s *PluginService) Ping(name string) (bool, error) {
@@ -254,13 +579,13 @@ func (s *PluginService) Ping(name string) (bool, error) {
 	return resp.Error == nil, nil
 }
 
+// ListRunning returns the names of the plugins recorded as running in the
+// sockets dir.
 func (s *PluginService) ListRunning() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	names := make([]string, 0, len(s.plugins))
-	for name := range s.plugins {
-		names = append(names, name)
+	running := s.Running()
+	names := make([]string, 0, len(running))
+	for _, p := range running {
+		names = append(names, p.Name)
 	}
 	return names
 }
@@ -308,7 +633,25 @@ func hasHook(hooks []string, target string) bool {
 	return false
 }
 
+// isAlive reports whether a known plugin can still be used. It avoids
+// dialing: a plugin this process supervises is alive until it is reaped,
+// and one started elsewhere while its connection is open or it answered
+// recently.
 func (s *PluginService) isAlive(info *PluginInfo) bool {
+	s.mu.RLock()
+	exited, conn := info.exited, info.conn
+	s.mu.RUnlock()
+	if exited != nil {
+		select {
+		case <-exited:
+			return false
+		default:
+			return true
+		}
+	}
+	if conn != nil && (!conn.isClosed() || conn.answeredWithin(aliveWindow)) {
+		return true
+	}
 	return s.isSocketAlive(info.SocketPath)
 }
 
@@ -321,7 +664,11 @@ func (s *PluginService) isSocketAlive(socketPath string) bool {
 	return true
 }
 
-func (s *PluginService) waitForSocket(path string, timeout time.Duration) error {
+var errExited = errors.New("plugin exited")
+
+// waitForSocket waits for a plugin to accept connections on path, giving
+// up early once exited is closed.
+func (s *PluginService) waitForSocket(path string, timeout time.Duration, exited <-chan struct{}) error {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
 		conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
@@ -329,7 +676,11 @@ func (s *PluginService) waitForSocket(path string, timeout time.Duration) error
 			conn.Close()
 			return nil
 		}
-		time.Sleep(50 * time.Millisecond)
+		select {
+		case <-exited:
+			return errExited
+		case <-time.After(50 * time.Millisecond):
+		}
 	}
 	return fmt.Errorf("timeout waiting for socket")
 }
@@ -0,0 +1,435 @@
+package plugin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Where a plugin was installed from, as recorded in PluginEntry.Source.
+const (
+	SourceGit     = "git"
+	SourcePath    = "path"
+	SourceLink    = "link"
+	SourceArchive = "archive"
+)
+
+// InstallOptions tune how Install treats local sources.
+type InstallOptions struct {
+	// Link symlinks a local plugin directory instead of copying it.
+	Link bool
+	// SHA256 is the expected checksum of an archive, hex encoded.
+	SHA256 string
+}
+
+const downloadTimeout = 2 * time.Minute
+
+// sourceKind tells how source should be installed: from an archive, a
+// local directory or a git repository. path is the local path or archive
+// location with any file:// prefix removed.
+func sourceKind(source string) (kind, path string) {
+	path = source
+	isFile := strings.HasPrefix(source, "file://")
+	if isFile {
+		path = strings.TrimPrefix(source, "file://")
+	}
+	if isArchive(path) {
+		return SourceArchive, path
+	}
+	if isFile {
+		return SourcePath, path
+	}
+	// A ref or a bare repository makes a local path a git source.
+	if _, ref := SplitSource(source); ref != "" || isBareRepo(path) {
+		return SourceGit, source
+	}
+	if isLocalPath(path) {
+		return SourcePath, path
+	}
+	return SourceGit, source
+}
+
+func isBareRepo(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "HEAD"))
+	_, manifestErr := os.Stat(filepath.Join(path, "plugin.json"))
+	return err == nil && manifestErr != nil
+}
+
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	return strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz") || strings.HasSuffix(lower, ".zip")
+}
+
+func isLocalPath(path string) bool {
+	if strings.HasPrefix(path, ".") || strings.HasPrefix(path, "/") || strings.HasPrefix(path, "~") {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// installLocal copies or links the plugin directory at path.
+func (s *PluginInstallerService) installLocal(path string, link bool, approve Approver) (*PluginEntry, error) {
+	src, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("plugin directory not found: %s", src)
+	}
+	manifest, err := s.loadManifest(src, "")
+	if err != nil {
+		return nil, err
+	}
+	dest, err := s.destination(manifest.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !approve(manifest.Name, manifest.Capabilities, nil) {
+		return nil, ErrNotGranted
+	}
+
+	kind := SourcePath
+	if link {
+		kind = SourceLink
+		err = os.Symlink(src, dest)
+	} else {
+		err = copyDir(src, dest)
+	}
+	if err != nil {
+		os.RemoveAll(dest)
+		return nil, fmt.Errorf("install %s: %w", src, err)
+	}
+	// A linked plugin is built in its source tree, where its module and
+	// relative paths resolve.
+	buildDir := dest
+	if link {
+		buildDir = src
+	}
+	if err := s.build(manifest, buildDir); err != nil {
+		os.RemoveAll(dest)
+		return nil, err
+	}
+	entry := entryFromManifest(manifest, "file://"+src)
+	entry.Source = kind
+	return s.register(entry)
+}
+
+// installArchive downloads or opens a .tar.gz or .zip archive, checks its
+// checksum and extracts it.
+func (s *PluginInstallerService) installArchive(location, checksum string, approve Approver) (*PluginEntry, error) {
+	if err := os.MkdirAll(s.pluginsDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create plugins dir: %w", err)
+	}
+	archive, cleanup, err := fetchArchive(location)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	sum, err := fileSHA256(archive)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != "" && !strings.EqualFold(sum, checksum) {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", location, sum, checksum)
+	}
+
+	tmp, err := os.MkdirTemp(s.pluginsDir, ".extract-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		err = extractZip(archive, tmp)
+	} else {
+		err = extractTarGz(archive, tmp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("extract %s: %w", location, err)
+	}
+
+	root := archiveRoot(tmp)
+	manifest, err := s.loadManifest(root, "")
+	if err != nil {
+		return nil, err
+	}
+	dest, err := s.destination(manifest.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !approve(manifest.Name, manifest.Capabilities, nil) {
+		return nil, ErrNotGranted
+	}
+	if err := os.Rename(root, dest); err != nil {
+		return nil, fmt.Errorf("install %s: %w", location, err)
+	}
+	if err := s.build(manifest, dest); err != nil {
+		os.RemoveAll(dest)
+		return nil, err
+	}
+	entry := entryFromManifest(manifest, location)
+	entry.Source = SourceArchive
+	entry.Checksum = sum
+	return s.register(entry)
+}
+
+// destination returns where plugin name is installed, failing when it is
+// already there.
+func (s *PluginInstallerService) destination(name string) (string, error) {
+	if err := os.MkdirAll(s.pluginsDir, 0o755); err != nil {
+		return "", fmt.Errorf("create plugins dir: %w", err)
+	}
+	dest := filepath.Join(s.pluginsDir, name)
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("plugin %q already exists at %s", name, dest)
+	}
+	return dest, nil
+}
+
+func (s *PluginInstallerService) register(entry PluginEntry) (*PluginEntry, error) {
+	if err := s.registry.Add(entry); err != nil {
+		return nil, fmt.Errorf("register plugin: %w", err)
+	}
+	return &entry, nil
+}
+
+// fetchArchive returns a local path for the archive at location,
+// downloading it first when it is an http(s) URL.
+func fetchArchive(location string) (string, func(), error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		path, err := filepath.Abs(expandHome(location))
+		return path, func() {}, err
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return "", nil, fmt.Errorf("download %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("download %s: %s", location, resp.Status)
+	}
+
+	ext := ".tar.gz"
+	if strings.HasSuffix(strings.ToLower(location), ".zip") {
+		ext = ".zip"
+	}
+	f, err := os.CreateTemp("", "wf-plugin-*"+ext)
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("download %s: %w", location, err)
+	}
+	return f.Name(), cleanup, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// archiveRoot returns the plugin directory of an extracted archive: dir
+// itself, or its only subdirectory when the archive wraps the plugin in
+// one, as GitHub release archives do.
+func archiveRoot(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, "plugin.json")); err == nil {
+		return dir
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// safeJoin joins an archive member name to dir, rejecting names that
+// would escape it.
+func safeJoin(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if path != dir && !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q escapes the plugin directory", name)
+	}
+	return path, nil
+}
+
+func extractTarGz(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path, err := safeJoin(dir, hdr.Name)
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0o755)
+		case tar.TypeReg:
+			err = extractFile(path, tr, hdr.FileInfo().Mode())
+		case tar.TypeSymlink, tar.TypeLink:
+			// Links would let later entries write through them, outside
+			// the plugin directory.
+			return fmt.Errorf("archive entry %q is a link; plugin archives may not contain links", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(archive, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, zf := range zr.File {
+		path, err := safeJoin(dir, zf.Name)
+		if err != nil {
+			return err
+		}
+		if zf.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if zf.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("archive entry %q is a link; plugin archives may not contain links", zf.Name)
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(path, rc, zf.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// extractFile writes an archive member to path. It refuses to follow a
+// symlink or to overwrite an earlier member.
+func extractFile(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|syscall.O_NOFOLLOW, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyDir copies the plugin directory src to dest, keeping symlinks as
+// they are.
+func copyDir(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return writeFile(target, f, info.Mode())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"os/exec"
+	"time"
+)
+
+const (
+	// maxRestarts is how often a crashing plugin is restarted before wf
+	// gives up on it.
+	maxRestarts = 5
+	// restartBackoff is the delay before the first restart; it doubles
+	// with every further one.
+	restartBackoff = 500 * time.Millisecond
+	// restartResetAfter is how long a plugin must run before its earlier
+	// crashes are forgotten.
+	restartResetAfter = time.Minute
+)
+
+// supervise reaps the plugin process and restarts it when it exits while
+// still in use.
+func (s *PluginService) supervise(info *PluginInfo, cmd *exec.Cmd, manifest *Manifest) {
+	info.exitErr = cmd.Wait()
+	// Kill and Stop wait for exited while holding mu.
+	close(info.exited)
+
+	s.mu.Lock()
+	crashed := !info.stopping && s.plugins[info.Name] == info
+	s.mu.Unlock()
+
+	if crashed {
+		s.restart(info, manifest)
+	}
+}
+
+// restart starts a crashed plugin again with exponential backoff. It stops
+// once the plugin is up, after maxRestarts attempts, or when the plugin was
+// replaced or killed in the meantime.
+func (s *PluginService) restart(crashed *PluginInfo, manifest *Manifest) {
+	name := crashed.Name
+	restarts := crashed.restarts
+	if time.Since(crashed.started) > restartResetAfter {
+		restarts = 0
+	}
+
+	for restarts < maxRestarts {
+		delay := restartBackoff << restarts
+		restarts++
+		s.logEvent(name, "exited (%s); restarting in %s (%d/%d)", exitStatus(crashed.exitErr), delay, restarts, maxRestarts)
+		time.Sleep(delay)
+
+		if done := s.restartOnce(crashed, manifest, restarts); done {
+			return
+		}
+	}
+
+	s.logEvent(name, "crashed %d times; not restarting", maxRestarts)
+	s.mu.Lock()
+	if s.plugins[name] == crashed {
+		s.release(name, crashed)
+	}
+	s.mu.Unlock()
+}
+
+// restartOnce starts a crashed plugin unless it was replaced or killed in
+// the meantime. It reports whether restarting is over.
+func (s *PluginService) restartOnce(crashed *PluginInfo, manifest *Manifest, restarts int) bool {
+	name := crashed.Name
+	lock := s.startLock(name)
+	lock.Lock()
+	defer lock.Unlock()
+	unlock, err := s.lockStart(name)
+	if err != nil {
+		s.logEvent(name, "restart failed: %v", err)
+		return false
+	}
+	defer unlock()
+
+	s.mu.RLock()
+	current := s.plugins[name] == crashed
+	s.mu.RUnlock()
+	if !current {
+		return true
+	}
+	if s.isSocketAlive(crashed.SocketPath) {
+		// Another wf process started it again already; Wakeup adopts it.
+		s.mu.Lock()
+		delete(s.plugins, name)
+		s.mu.Unlock()
+		return true
+	}
+	info, err := s.start(name, manifest)
+	if err != nil {
+		s.logEvent(name, "restart failed: %v", err)
+		return false
+	}
+	info.restarts = restarts
+	s.mu.Lock()
+	s.plugins[name] = info
+	s.mu.Unlock()
+	return true
+}
+
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
@@ -0,0 +1,412 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// LockEntry records the commit a plugin resolved to.
+type LockEntry struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Ref     string `json:"ref,omitempty"`
+	Commit  string `json:"commit"`
+	Version string `json:"version,omitempty"`
+}
+
+type Lockfile struct {
+	Plugins []LockEntry `json:"plugins"`
+}
+
+// Update describes a plugin moved to another commit by Update.
+type Update struct {
+	Name      string
+	From      string
+	To        string
+	Version   string
+	Changelog []string
+}
+
+// Outdated describes a plugin whose remote has moved past its commit.
+type Outdated struct {
+	Name    string
+	Ref     string
+	Current string
+	Latest  string
+	// LatestTag is the newest tag of a plugin pinned to a tag.
+	LatestTag string
+	Behind    int
+}
+
+func DefaultLockPath() string {
+	configDir, _ := os.UserConfigDir()
+	return filepath.Join(configDir, "workforge", "plugins.lock")
+}
+
+// SplitSource splits "url@ref" into the repository URL and the tag, branch
+// or commit to check out; the ref may contain slashes, as in
+// repo@release/v2. An @ that is part of the URL, as in
+// git@github.com:org/repo or ssh://git@host/org/repo, is not taken as a
+// ref.
+func SplitSource(source string) (string, string) {
+	i := strings.LastIndex(source, "@")
+	if i <= 0 {
+		return source, ""
+	}
+	url, ref := source[:i], source[i+1:]
+	if ref == "" || strings.Contains(ref, ":") {
+		return source, ""
+	}
+	if _, rest, ok := strings.Cut(url, "://"); ok && !strings.Contains(rest, "/") {
+		// The @ ends the user of scheme://user@host/path.
+		return source, ""
+	}
+	return url, ref
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkout detaches the plugin repository at dir to ref and returns the
+// resolved commit.
+func checkout(dir, ref string) (string, error) {
+	if _, err := gitOutput(dir, "checkout", "--quiet", "--detach", ref); err != nil {
+		return "", err
+	}
+	return gitOutput(dir, "rev-parse", "HEAD")
+}
+
+// target resolves what a plugin should be at after fetching: its pinned
+// ref, or the remote default branch. A branch ref follows the remote
+// branch.
+func target(dir, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if commit, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", "origin/"+ref+"^{commit}"); err == nil {
+		return commit, nil
+	}
+	return gitOutput(dir, "rev-parse", ref+"^{commit}")
+}
+
+// isTag reports whether ref names a tag of the repository at dir.
+func isTag(dir, ref string) bool {
+	_, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", "refs/tags/"+ref)
+	return err == nil
+}
+
+// newestTag returns the highest version tag of the repository at dir, or ""
+// when it has none.
+func newestTag(dir string) (string, error) {
+	out, err := gitOutput(dir, "tag", "--list", "--sort=-v:refname")
+	if err != nil {
+		return "", err
+	}
+	tag, _, _ := strings.Cut(out, "\n")
+	return tag, nil
+}
+
+func fetch(dir string) error {
+	_, err := gitOutput(dir, "fetch", "--quiet", "--tags", "origin")
+	return err
+}
+
+func changelog(dir, from, to string) []string {
+	out, err := gitOutput(dir, "log", "--oneline", "--no-decorate", from+".."+to)
+	if err != nil || out == "" {
+		return nil
+	}
+	return strings.Split(out, "\n")
+}
+
+func isGitSource(entry PluginEntry) bool {
+	if entry.Source != "" {
+		return entry.Source == SourceGit
+	}
+	return entry.URL != "" && entry.URL != "local"
+}
+
+// Update fetches the named plugins, or every plugin installed from git
+// when names is empty, and checks out their pinned ref or the latest
+// commit of the default branch. A ref given as name@ref re-pins the
+// plugin. approve is asked again when the new manifest requests more.
+func (s *PluginInstallerService) Update(names []string, approve Approver) ([]Update, error) {
+	entries, err := s.selectGitPlugins(names)
+	if err != nil {
+		return nil, err
+	}
+	var updates []Update
+	for _, sel := range entries {
+		u, err := s.update(sel.entry, sel.ref, approve)
+		if err != nil {
+			return updates, fmt.Errorf("update %s: %w", sel.entry.Name, err)
+		}
+		if u != nil {
+			updates = append(updates, *u)
+		}
+	}
+	return updates, s.writeLock()
+}
+
+type selectedPlugin struct {
+	entry PluginEntry
+	ref   *string
+}
+
+func (s *PluginInstallerService) selectGitPlugins(names []string) ([]selectedPlugin, error) {
+	if len(names) == 0 {
+		all, err := s.registry.List()
+		if err != nil {
+			return nil, err
+		}
+		var out []selectedPlugin
+		for _, entry := range all {
+			if isGitSource(entry) {
+				out = append(out, selectedPlugin{entry: entry})
+			}
+		}
+		return out, nil
+	}
+	out := make([]selectedPlugin, 0, len(names))
+	for _, arg := range names {
+		name, ref := SplitSource(arg)
+		entry, ok := s.registry.Find(name)
+		if !ok {
+			return nil, fmt.Errorf("plugin %q is not installed", name)
+		}
+		if !isGitSource(*entry) {
+			return nil, fmt.Errorf("plugin %q was not installed from git", name)
+		}
+		sel := selectedPlugin{entry: *entry}
+		if ref != "" {
+			sel.ref = &ref
+		}
+		out = append(out, sel)
+	}
+	return out, nil
+}
+
+func (s *PluginInstallerService) update(entry PluginEntry, ref *string, approve Approver) (*Update, error) {
+	dir := filepath.Join(s.pluginsDir, entry.Name)
+	if err := fetch(dir); err != nil {
+		return nil, err
+	}
+	if ref != nil {
+		entry.Ref = *ref
+	}
+	from, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	to, err := target(dir, entry.Ref)
+	if err != nil {
+		return nil, err
+	}
+	if from == to {
+		if ref != nil {
+			return nil, s.registry.Add(entry)
+		}
+		return nil, nil
+	}
+	if _, err := checkout(dir, to); err != nil {
+		return nil, err
+	}
+	manifest, err := s.loadManifest(dir, entry.Name)
+	if err == nil {
+		err = s.approve(entry.Name, manifest, approve)
+	}
+	if err == nil {
+		err = s.build(manifest, dir)
+	}
+	if err != nil {
+		checkout(dir, from)
+		return nil, err
+	}
+
+	updated := entryFromManifest(manifest, entry.URL)
+	updated.Source = SourceGit
+	updated.Ref = entry.Ref
+	updated.Commit = to
+	if err := s.registry.Add(updated); err != nil {
+		return nil, err
+	}
+	return &Update{
+		Name:      entry.Name,
+		From:      from,
+		To:        to,
+		Version:   manifest.Version,
+		Changelog: changelog(dir, from, to),
+	}, nil
+}
+
+// Outdated fetches every plugin installed from git and reports those with
+// newer commits: the newest tag for a plugin pinned to a tag, the remote
+// branch for one pinned to a branch, and the default branch otherwise.
+func (s *PluginInstallerService) Outdated() ([]Outdated, error) {
+	all, err := s.registry.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []Outdated
+	for _, entry := range all {
+		if !isGitSource(entry) {
+			continue
+		}
+		dir := filepath.Join(s.pluginsDir, entry.Name)
+		if err := fetch(dir); err != nil {
+			return out, fmt.Errorf("fetch %s: %w", entry.Name, err)
+		}
+		current, err := gitOutput(dir, "rev-parse", "HEAD")
+		if err != nil {
+			return out, err
+		}
+		o := Outdated{Name: entry.Name, Ref: entry.Ref, Current: current}
+		if o.Latest, o.LatestTag, err = latest(dir, entry.Ref); err != nil {
+			return out, err
+		}
+		if current == o.Latest {
+			continue
+		}
+		if count, err := gitOutput(dir, "rev-list", "--count", current+".."+o.Latest); err == nil {
+			fmt.Sscan(count, &o.Behind)
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// latest resolves the newest commit a plugin pinned to ref could move to,
+// and the tag it is at when ref is a tag.
+func latest(dir, ref string) (string, string, error) {
+	if ref != "" && isTag(dir, ref) {
+		tag, err := newestTag(dir)
+		if err != nil {
+			return "", "", err
+		}
+		commit, err := gitOutput(dir, "rev-parse", tag+"^{commit}")
+		return commit, tag, err
+	}
+	if ref != "" {
+		if commit, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", "origin/"+ref+"^{commit}"); err == nil {
+			return commit, "", nil
+		}
+	}
+	commit, err := target(dir, "")
+	return commit, "", err
+}
+
+// LoadLock reads a lockfile; a missing file is an empty lock.
+func LoadLock(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Lockfile{Plugins: []LockEntry{}}, nil
+		}
+		return nil, err
+	}
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &lock, nil
+}
+
+// writeLock records the commit of every plugin installed from git.
+func (s *PluginInstallerService) writeLock() error {
+	all, err := s.registry.List()
+	if err != nil {
+		return err
+	}
+	lock := Lockfile{Plugins: []LockEntry{}}
+	for _, entry := range all {
+		if !isGitSource(entry) || entry.Commit == "" {
+			continue
+		}
+		lock.Plugins = append(lock.Plugins, LockEntry{
+			Name:    entry.Name,
+			URL:     entry.URL,
+			Ref:     entry.Ref,
+			Commit:  entry.Commit,
+			Version: entry.Version,
+		})
+	}
+	if err := os.MkdirAll(filepath.Dir(s.lockPath), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.lockPath, data, 0o644)
+}
+
+// Sync installs or checks out every plugin of the lockfile at path at its
+// recorded commit. It returns the names of the plugins it changed.
+func (s *PluginInstallerService) Sync(path string, approve Approver) ([]string, error) {
+	lock, err := LoadLock(path)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, locked := range lock.Plugins {
+		ok, err := s.syncOne(locked, approve)
+		if err != nil {
+			return changed, fmt.Errorf("sync %s: %w", locked.Name, err)
+		}
+		if ok {
+			changed = append(changed, locked.Name)
+		}
+	}
+	return changed, s.writeLock()
+}
+
+func (s *PluginInstallerService) syncOne(locked LockEntry, approve Approver) (bool, error) {
+	entry, ok := s.registry.Find(locked.Name)
+	if !ok {
+		_, err := s.install(locked.URL, locked.Commit, locked.Ref, approve)
+		return err == nil, err
+	}
+	if entry.Commit == locked.Commit {
+		return false, nil
+	}
+	dir := filepath.Join(s.pluginsDir, locked.Name)
+	if err := fetch(dir); err != nil {
+		return false, err
+	}
+	from, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return false, err
+	}
+	if _, err := checkout(dir, locked.Commit); err != nil {
+		return false, err
+	}
+	manifest, err := s.loadManifest(dir, locked.Name)
+	if err == nil {
+		err = s.approve(locked.Name, manifest, approve)
+	}
+	if err == nil {
+		err = s.build(manifest, dir)
+	}
+	if err != nil {
+		checkout(dir, from)
+		return false, err
+	}
+	updated := entryFromManifest(manifest, locked.URL)
+	updated.Source = SourceGit
+	updated.Ref = locked.Ref
+	updated.Commit = locked.Commit
+	return true, s.registry.Add(updated)
+}
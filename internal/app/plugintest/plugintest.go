@@ -0,0 +1,192 @@
+// Package plugintest exercises a plugin directory the way wf would use it:
+// it starts the plugin in an isolated plugins and sockets dir, sends it
+// every hook it declares and checks that it answers pings and shuts down
+// when asked.
+package plugintest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"workforge/internal/app/hook"
+	"workforge/internal/app/plugin"
+)
+
+// SlowResponse is the reply time above which a hook is reported as slow.
+const SlowResponse = time.Second
+
+// shutdownTimeout is how long a plugin gets to exit after "shutdown".
+const shutdownTimeout = 5 * time.Second
+
+// Project is the project name sent in sample payloads.
+const Project = "plugin-test"
+
+// ErrFailed is returned by Run when any check failed.
+var ErrFailed = errors.New("plugin test failed")
+
+// Run tests the plugin in dir and prints one line per check. The plugin
+// is built and linked into a temporary plugins dir with all the
+// capabilities it requests granted; nothing of the user's setup is used
+// except through host, which serves the plugin's host calls.
+func Run(dir string, rules plugin.ManifestRules, host map[string]plugin.HostMethod) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	manifest, issues := plugin.ValidateManifest(dir, "", rules)
+	if plugin.HasManifestErrors(issues) {
+		return &plugin.ManifestError{Dir: dir, Issues: issues}
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+
+	tmp, err := os.MkdirTemp("", "wf-plugin-test-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	pluginsDir := filepath.Join(tmp, "plugins")
+	registry := plugin.NewPluginRegistryService(filepath.Join(tmp, "plugins.json"))
+	installer := plugin.NewPluginInstallerService(pluginsDir, registry, filepath.Join(tmp, "plugins.lock"), rules)
+	installer.SetBuildOutput(os.Stdout)
+	grantAll := func(string, plugin.Capabilities, *plugin.Capabilities) bool { return true }
+	entry, err := installer.Install(dir, plugin.InstallOptions{Link: true}, grantAll)
+	if err != nil {
+		return err
+	}
+
+	pluginSvc := plugin.NewPluginService(pluginsDir, filepath.Join(tmp, "sockets"), registry)
+	pluginSvc.SetLogsDir(filepath.Join(tmp, "logs"))
+	pluginSvc.SetHostMethods(host)
+	defer pluginSvc.StopHost()
+	defer pluginSvc.KillAll()
+	hooks := hook.NewHookService(pluginSvc, registry)
+
+	t := &tester{}
+	start := time.Now()
+	if err := pluginSvc.Wakeup(entry.Name); err != nil {
+		t.fail("start", time.Since(start), err)
+		return ErrFailed
+	}
+	t.timed("start", time.Since(start), plugin.RuntimeStartTimeout(manifest.Runtime))
+
+	t.ping(pluginSvc, entry.Name, "ping")
+
+	var payloads []*hook.HookPayload
+	for _, name := range entry.Hooks {
+		payload := SamplePayload(hook.HookType(name), entry.ConfigKey)
+		payloads = append(payloads, payload)
+		result := hooks.Call(*entry, payload)
+		if result.Error != nil {
+			t.fail(name, result.Duration, result.Error)
+			continue
+		}
+		t.timed(name, result.Duration, SlowResponse)
+		if result.Reply != nil {
+			reply, _ := json.Marshal(result.Reply)
+			fmt.Printf("      reply: %s\n", reply)
+		}
+	}
+
+	hooks.Notify(payloads...)
+	t.ping(pluginSvc, entry.Name, "notifications")
+
+	start = time.Now()
+	exited, err := pluginSvc.Stop(entry.Name, shutdownTimeout)
+	switch {
+	case err != nil:
+		t.fail("shutdown", time.Since(start), err)
+	case !exited:
+		t.fail("shutdown", time.Since(start), fmt.Errorf("still running %s after shutdown, killed", shutdownTimeout))
+	default:
+		t.ok("shutdown", time.Since(start))
+	}
+
+	if t.failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", t.failed, t.checks)
+		return ErrFailed
+	}
+	fmt.Printf("all %d checks passed\n", t.checks)
+	return nil
+}
+
+// SamplePayload builds the payload wf would send for hookType, with
+// placeholder values for the fields it carries and an empty config
+// section under configKey.
+func SamplePayload(hookType hook.HookType, configKey string) *hook.HookPayload {
+	p := hook.NewPayload(Project, hookType)
+	switch hookType {
+	case hook.HookPreOpen:
+		p.WithField(hook.FieldPath, "/tmp/"+Project).
+			WithField(hook.FieldBranch, "main").
+			WithField(hook.FieldProfile, "default")
+	case hook.HookPreDelete:
+		p.WithField(hook.FieldPath, "/tmp/"+Project).
+			WithField(hook.FieldBranch, "main")
+	case hook.HookOnTmuxSessionStart:
+		p.WithSession(Project + "/main")
+	case hook.HookOnTmuxWindow:
+		p.WithSession(Project + "/main").WithWindow(0).WithCommand("nvim .")
+	case hook.HookOnTaskStart:
+		p.WithTask("build")
+	case hook.HookOnTaskEnd:
+		p.WithTask("build").WithErrorMsg("task build command 1 failed: exit status 1")
+	case hook.HookOnError:
+		p.WithErrorMsg("sample error").WithSource("plugin-test")
+	case hook.HookOnWarning:
+		p.WithWarning("sample warning").WithSource("plugin-test")
+	case hook.HookOnMessage:
+		p.WithMessage("sample message").WithSource("plugin-test")
+	case hook.HookOnDebug:
+		p.WithMessage("sample debug message").WithContext("plugin-test")
+	}
+	if configKey != "" {
+		p.WithConfig(map[string]any{configKey: map[string]any{}})
+	}
+	return p
+}
+
+type tester struct {
+	checks int
+	failed int
+}
+
+func (t *tester) ok(name string, d time.Duration) {
+	t.checks++
+	fmt.Printf("ok    %-24s %s\n", name, d.Round(time.Millisecond))
+}
+
+func (t *tester) fail(name string, d time.Duration, err error) {
+	t.checks++
+	t.failed++
+	fmt.Printf("FAIL  %-24s %s: %v\n", name, d.Round(time.Millisecond), err)
+}
+
+// timed passes the check, warning when it took longer than slow.
+func (t *tester) timed(name string, d, slow time.Duration) {
+	if d <= slow {
+		t.ok(name, d)
+		return
+	}
+	t.checks++
+	fmt.Printf("slow  %-24s %s (over %s)\n", name, d.Round(time.Millisecond), slow)
+}
+
+func (t *tester) ping(pluginSvc *plugin.PluginService, name, check string) {
+	start := time.Now()
+	ok, err := pluginSvc.Ping(name)
+	if err == nil && !ok {
+		err = fmt.Errorf("no answer to on_ping")
+	}
+	if err != nil {
+		t.fail(check, time.Since(start), err)
+		return
+	}
+	t.ok(check, time.Since(start))
+}
@@ -103,6 +103,24 @@ func (s *ProjectService) FindProjectEntry(name string) (ProjectEntry, error) {
 	return ProjectEntry{Project: project, IsGWT: hitmap[name]}, nil
 }
 
+// FindProjectEntryByPath returns the registered project whose path is dir.
+func (s *ProjectService) FindProjectEntryByPath(dir string) (ProjectEntry, bool) {
+	target, err := s.registry.paths.NormalizePath(dir)
+	if err != nil {
+		return ProjectEntry{}, false
+	}
+	entries, err := s.SortedProjectEntries()
+	if err != nil {
+		return ProjectEntry{}, false
+	}
+	for _, entry := range entries {
+		if p, err := s.registry.paths.NormalizePath(entry.Path); err == nil && p == target {
+			return entry, true
+		}
+	}
+	return ProjectEntry{}, false
+}
+
 func (s *ProjectService) GetProjectPath(name string) (string, bool, error) {
 	entry, err := s.FindProjectEntry(name)
 	if err != nil {
@@ -0,0 +1,292 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"workforge/internal/infra/fs"
+)
+
+// WorktreeState is what wf remembers about the hooks of one worktree.
+type WorktreeState struct {
+	Once       map[string]time.Time         `json:"once,omitempty"`
+	Inputs     map[string]InputsHash        `json:"inputs,omitempty"`
+	Background map[string]BackgroundCommand `json:"background,omitempty"`
+}
+
+// InputsHash records the hash of a command's `inputs:` after its last
+// successful run.
+type InputsHash struct {
+	Hash string    `json:"hash"`
+	At   time.Time `json:"at"`
+}
+
+// BackgroundCommand is a `background: true` command still running
+// detached from the wf process that started it. Start identifies the
+// process behind PID (see exec.ProcessStart), so that a reused PID is not
+// mistaken for it.
+type BackgroundCommand struct {
+	PID     int       `json:"pid"`
+	Start   string    `json:"start,omitempty"`
+	Log     string    `json:"log"`
+	Started time.Time `json:"started"`
+}
+
+// HookState is keyed by absolute worktree path.
+type HookState map[string]*WorktreeState
+
+type HookStateService struct {
+	paths *fs.PathResolver
+	mu    sync.Mutex
+}
+
+func NewHookStateService() *HookStateService {
+	return &HookStateService{paths: fs.NewPathResolver()}
+}
+
+func (s *HookStateService) load() (HookState, string, error) {
+	path, err := s.paths.HookStatePath()
+	if err != nil {
+		return nil, "", err
+	}
+	st := make(HookState)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, path, nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading hook state: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, "", fmt.Errorf("error parsing hook state %s: %w", path, err)
+		}
+	}
+	return st, path, nil
+}
+
+// save replaces the state file in one step, so readers never see it half
+// written.
+func (s *HookStateService) save(st HookState, path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling JSON: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".hook-state-*")
+	if err != nil {
+		return fmt.Errorf("error writing hook state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing hook state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing hook state: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("error writing hook state: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lock serializes changes to the state file between wf processes. Callers
+// hold mu.
+func (s *HookStateService) lock() (func(), error) {
+	path, err := s.paths.HookStatePath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create workforge config directory: %w", err)
+	}
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error locking hook state: %w", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error locking hook state: %w", err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// update applies fn to the state of worktree and saves the result.
+func (s *HookStateService) update(worktree string, fn func(ws *WorktreeState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	st, path, err := s.load()
+	if err != nil {
+		return err
+	}
+	ws := st[worktree]
+	if ws == nil {
+		ws = &WorktreeState{}
+		st[worktree] = ws
+	}
+	fn(ws)
+	return s.save(st, path)
+}
+
+func (s *HookStateService) get(worktree string) (*WorktreeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if ws := st[worktree]; ws != nil {
+		return ws, nil
+	}
+	return &WorktreeState{}, nil
+}
+
+// OnceDone reports whether the `once:` command key already succeeded in
+// worktree.
+func (s *HookStateService) OnceDone(worktree, key string) (bool, error) {
+	ws, err := s.get(worktree)
+	if err != nil {
+		return false, err
+	}
+	_, ok := ws.Once[key]
+	return ok, nil
+}
+
+func (s *HookStateService) MarkOnce(worktree, key string) error {
+	return s.update(worktree, func(ws *WorktreeState) {
+		if ws.Once == nil {
+			ws.Once = make(map[string]time.Time)
+		}
+		ws.Once[key] = time.Now()
+	})
+}
+
+// InputsUnchanged reports whether hash matches the last successful run of
+// the command key in worktree.
+func (s *HookStateService) InputsUnchanged(worktree, key, hash string) (bool, error) {
+	ws, err := s.get(worktree)
+	if err != nil {
+		return false, err
+	}
+	prev, ok := ws.Inputs[key]
+	return ok && prev.Hash == hash, nil
+}
+
+func (s *HookStateService) RecordInputs(worktree, key, hash string) error {
+	return s.update(worktree, func(ws *WorktreeState) {
+		if ws.Inputs == nil {
+			ws.Inputs = make(map[string]InputsHash)
+		}
+		ws.Inputs[key] = InputsHash{Hash: hash, At: time.Now()}
+	})
+}
+
+func (s *HookStateService) RecordBackground(worktree, key string, bg BackgroundCommand) error {
+	return s.update(worktree, func(ws *WorktreeState) {
+		if ws.Background == nil {
+			ws.Background = make(map[string]BackgroundCommand)
+		}
+		ws.Background[key] = bg
+	})
+}
+
+// RemoveBackground forgets the background command key of worktree unless
+// it was started again since as another process.
+func (s *HookStateService) RemoveBackground(worktree, key string, pid int) error {
+	return s.update(worktree, func(ws *WorktreeState) {
+		if bg, ok := ws.Background[key]; ok && bg.PID == pid {
+			delete(ws.Background, key)
+		}
+	})
+}
+
+// BackgroundLog is the file the output of the background command key of
+// worktree goes to.
+func (s *HookStateService) BackgroundLog(worktree, key string) (string, error) {
+	stateDir, err := s.paths.StateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(worktree + "\x00" + key))
+	name := fmt.Sprintf("%s-%x.log", filepath.Base(worktree), sum[:4])
+	return filepath.Join(stateDir, "background", name), nil
+}
+
+// Background returns the background commands recorded for worktree.
+func (s *HookStateService) Background(worktree string) (map[string]BackgroundCommand, error) {
+	ws, err := s.get(worktree)
+	if err != nil {
+		return nil, err
+	}
+	return ws.Background, nil
+}
+
+func (s *HookStateService) All() (HookState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, _, err := s.load()
+	return st, err
+}
+
+// Clear forgets the recorded `inputs:` hashes of every worktree at or
+// below root, or of all worktrees when root is empty, and with once their
+// `once:` runs too. Running background commands are kept. It returns the
+// worktrees that had something to clear.
+func (s *HookStateService) Clear(root string, once bool) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	st, path, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var cleared []string
+	for worktree, ws := range st {
+		if !Within(worktree, root) {
+			continue
+		}
+		if len(ws.Inputs) == 0 && (!once || len(ws.Once) == 0) {
+			continue
+		}
+		ws.Inputs = nil
+		if once {
+			ws.Once = nil
+		}
+		if len(ws.Once) == 0 && len(ws.Background) == 0 {
+			delete(st, worktree)
+		}
+		cleared = append(cleared, worktree)
+	}
+	if len(cleared) == 0 {
+		return nil, nil
+	}
+	return cleared, s.save(st, path)
+}
+
+// Within reports whether worktree is root or below it; an empty root
+// contains everything.
+func Within(worktree, root string) bool {
+	if root == "" || worktree == root {
+		return true
+	}
+	return strings.HasPrefix(worktree, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
@@ -0,0 +1,339 @@
+package terminal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"workforge/internal/app/config"
+	"workforge/internal/app/hook"
+	"workforge/internal/app/state"
+	"workforge/internal/infra/exec"
+)
+
+// step is one hook entry with the entries it waits for.
+type step struct {
+	index int
+	cmd   config.Command
+	label string
+	deps  []int
+}
+
+// planCommands turns a hook list into a DAG. An entry with depends_on waits
+// for exactly those entries. Otherwise a plain entry waits for every earlier
+// entry, and a run of parallel entries waits for what precedes the run.
+// Nothing waits for a background entry beyond its start.
+func planCommands(commands []config.Command) ([]step, error) {
+	byName := make(map[string]int)
+	for i, c := range commands {
+		if c.Name == "" {
+			continue
+		}
+		if _, dup := byName[c.Name]; dup {
+			return nil, fmt.Errorf("duplicate command name %q", c.Name)
+		}
+		byName[c.Name] = i
+	}
+
+	steps := make([]step, len(commands))
+	var finished, runDeps []int
+	inRun := false
+	for i, c := range commands {
+		st := step{index: i, cmd: c, label: commandLabel(c)}
+		switch {
+		case len(c.DependsOn) > 0:
+			for _, name := range c.DependsOn {
+				j, ok := byName[name]
+				if !ok {
+					return nil, fmt.Errorf("command %d depends on unknown command %q", i+1, name)
+				}
+				st.deps = append(st.deps, j)
+			}
+		case c.Parallel:
+			if !inRun {
+				runDeps = append([]int(nil), finished...)
+				inRun = true
+			}
+			st.deps = runDeps
+		default:
+			st.deps = append([]int(nil), finished...)
+		}
+		if !c.Parallel && !c.Background {
+			inRun = false
+		}
+		if !c.Background {
+			finished = append(finished, i)
+		}
+		steps[i] = st
+	}
+
+	if err := checkCycles(steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func checkCycles(steps []step) error {
+	state := make([]int, len(steps)) // 1 = visiting, 2 = done
+	var visit func(i int, chain []string) error
+	visit = func(i int, chain []string) error {
+		chain = append(chain, steps[i].label)
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("command dependency cycle: %s", strings.Join(chain, " -> "))
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, dep := range steps[i].deps {
+			if err := visit(dep, chain); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		return nil
+	}
+	for i := range steps {
+		if err := visit(i, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commandLabel names an entry in prefixed output: its name, or the first
+// word of the command.
+func commandLabel(c config.Command) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	if fields := strings.Fields(c.Run); len(fields) > 0 {
+		return fields[0]
+	}
+	return "command"
+}
+
+// runSteps starts every step as soon as its dependencies finish. After a
+// failure no new step starts; running ones are left to finish.
+func (s *TerminalService) runSteps(ctx context.Context, hookType hook.HookType, steps []step, session Session) error {
+	done := make([]chan struct{}, len(steps))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	succeeded := make([]bool, len(steps))
+
+	var (
+		wg       sync.WaitGroup
+		aborted  atomic.Bool
+		errMu    sync.Mutex
+		firstErr error
+	)
+	for _, st := range steps {
+		wg.Add(1)
+		go func(st step) {
+			defer wg.Done()
+			defer close(done[st.index])
+			for _, dep := range st.deps {
+				<-done[dep]
+				if !succeeded[dep] {
+					s.log.Debug("terminal", "skipping %s command #%d: %s did not succeed", hookType, st.index+1, steps[dep].label)
+					return
+				}
+			}
+			if aborted.Load() || ctx.Err() != nil {
+				return
+			}
+
+			reason, err := s.skipReason(ctx, hookType, st, session)
+			if err == nil && reason != "" {
+				s.log.Debug("terminal", "skipping %s command #%d: %s", hookType, st.index+1, reason)
+				succeeded[st.index] = true
+				return
+			}
+			if err == nil {
+				s.log.Debug("terminal", "running %s command #%d: %s", hookType, st.index+1, st.cmd.Run)
+				err = s.runStep(ctx, hookType, st, session)
+			}
+			if err == nil {
+				s.recordSuccess(hookType, st, session)
+				succeeded[st.index] = true
+				return
+			}
+			if st.cmd.ContinueOnError {
+				s.log.Warn("terminal", "%s command %d %v (continuing)", hookType, st.index+1, err)
+				succeeded[st.index] = true
+				return
+			}
+			aborted.Store(true)
+			errMu.Lock()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s command %d %w", hookType, st.index+1, err)
+			}
+			errMu.Unlock()
+		}(st)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// recordSuccess remembers a successful `once:` or `inputs:` command.
+func (s *TerminalService) recordSuccess(hookType hook.HookType, st step, session Session) {
+	key := stateKey(hookType, st.cmd)
+	if st.cmd.Once {
+		if err := s.state.MarkOnce(session.Worktree, key); err != nil {
+			s.log.Warn("terminal", "could not record %s command %d: %v", hookType, st.index+1, err)
+		}
+	}
+	if len(st.cmd.Inputs) > 0 {
+		hash, err := hashInputs(session.Worktree, st.cmd.Inputs)
+		if err == nil {
+			err = s.state.RecordInputs(session.Worktree, key, hash)
+		}
+		if err != nil {
+			s.log.Warn("terminal", "could not record %s command %d: %v", hookType, st.index+1, err)
+		}
+	}
+}
+
+// runStep runs a plain entry attached to the terminal; entries that may run
+// alongside others get their output prefixed with their label.
+func (s *TerminalService) runStep(ctx context.Context, hookType hook.HookType, st step, session Session) error {
+	if st.cmd.Background {
+		return s.startBackground(ctx, hookType, st, session)
+	}
+	if !st.cmd.Concurrent() {
+		return s.runCommand(ctx, st.cmd, session, nil, nil)
+	}
+	prefix := fmt.Sprintf("[%s] ", st.label)
+	stdout := newPrefixWriter(&s.outputMu, os.Stdout, prefix)
+	stderr := newPrefixWriter(&s.outputMu, os.Stderr, prefix)
+	defer stdout.Flush()
+	defer stderr.Flush()
+	return s.runCommand(ctx, st.cmd, session, stdout, stderr)
+}
+
+// startBackground starts a background entry detached from wf, with its
+// output in a log file. It outlives the hook and wf itself and runs until
+// it exits or StopBackground is called for its worktree; its timeout only
+// applies while wf runs. An entry still running from an earlier run is not
+// started again.
+func (s *TerminalService) startBackground(ctx context.Context, hookType hook.HookType, st step, session Session) error {
+	key := stateKey(hookType, st.cmd)
+	running, err := s.state.Background(session.Worktree)
+	if err != nil {
+		return err
+	}
+	if bg, ok := running[key]; ok && exec.SameProcess(bg.PID, bg.Start) {
+		s.log.Info("terminal", "background command %s already running (pid %d), output in %s", st.label, bg.PID, bg.Log)
+		return nil
+	}
+
+	logPath, err := s.state.BackgroundLog(session.Worktree, key)
+	if err != nil {
+		return err
+	}
+	bgCtx := context.WithoutCancel(ctx)
+	cancel := func() {}
+	if st.cmd.Timeout > 0 {
+		bgCtx, cancel = context.WithTimeout(bgCtx, st.cmd.Timeout)
+	}
+	cmd, err := exec.StartDetachedUserShell(bgCtx, st.cmd.Run, logPath, session.Env...)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to start: %w", err)
+	}
+	pid := cmd.Process.Pid
+	bg := state.BackgroundCommand{PID: pid, Start: exec.ProcessStart(pid), Log: logPath, Started: time.Now()}
+	if err := s.state.RecordBackground(session.Worktree, key, bg); err != nil {
+		s.log.Warn("terminal", "could not record background command %s: %v", st.label, err)
+	}
+	s.log.Info("terminal", "started background command %s (pid %d), output in %s", st.label, pid, logPath)
+
+	go func() {
+		err := cmd.Wait()
+		cancel()
+		s.state.RemoveBackground(session.Worktree, key, pid)
+		if err != nil {
+			s.log.Warn("terminal", "background command %s exited: %v", st.label, err)
+		}
+	}()
+	return nil
+}
+
+// StopBackground stops the background commands recorded for worktree,
+// whichever wf process started them, and waits for them to exit. A record
+// whose process is gone, or whose PID now belongs to another process, is
+// only forgotten.
+func (s *TerminalService) StopBackground(worktree string) error {
+	running, err := s.state.Background(worktree)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for key, bg := range running {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !exec.SameProcess(bg.PID, bg.Start) {
+				s.state.RemoveBackground(worktree, key, bg.PID)
+				return
+			}
+			s.log.Debug("terminal", "stopping background command %s (pid %d)", key, bg.PID)
+			if err := exec.KillProcessGroup(bg.PID); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				s.log.Warn("terminal", "could not stop background command %s: %v", key, err)
+				return
+			}
+			s.state.RemoveBackground(worktree, key, bg.PID)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// LogHooks runs a profile's on_error, on_warning and on_message commands for
+// LogService. The message and where it came from are passed in WF_MESSAGE
+// and WF_CONTEXT. What the commands log does not run log hooks again, nor
+// does a wf they start, which sees WF_HOOK.
+type LogHooks struct {
+	terminal *TerminalService
+	hooks    config.Hooks
+	session  Session
+}
+
+func (s *TerminalService) LogHooks(hooks config.Hooks, session Session) *LogHooks {
+	quiet := &TerminalService{hooks: s.hooks, log: s.log.WithoutShellHooks(), state: s.state}
+	return &LogHooks{terminal: quiet, hooks: hooks, session: session}
+}
+
+func (h *LogHooks) RunLogHook(hookType hook.HookType, message, source string) {
+	commands := h.hooks.Get(string(hookType))
+	if len(commands) == 0 || os.Getenv(config.EnvHook) != "" {
+		return
+	}
+	steps, err := planCommands(commands)
+	if err != nil {
+		h.terminal.log.Warn("terminal", "%s: %v", hookType, err)
+		return
+	}
+
+	session := h.session
+	session.Env = append(append([]string{}, h.session.Env...),
+		config.EnvHook+"="+string(hookType),
+		config.EnvMessage+"="+message,
+		config.EnvContext+"="+source,
+	)
+	ctx := context.Background()
+	if timeout := h.hooks.Timeout[string(hookType)]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := h.terminal.runSteps(ctx, hookType, steps, session); err != nil {
+		h.terminal.log.Warn("terminal", "%v", err)
+	}
+}
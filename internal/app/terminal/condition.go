@@ -0,0 +1,115 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"workforge/internal/app/config"
+	"workforge/internal/app/hook"
+	"workforge/internal/infra/exec"
+)
+
+// skipReason returns why st should not run, or "" when it should.
+func (s *TerminalService) skipReason(ctx context.Context, hookType hook.HookType, st step, session Session) (string, error) {
+	if st.cmd.Once {
+		done, err := s.state.OnceDone(session.Worktree, stateKey(hookType, st.cmd))
+		if err != nil {
+			return "", err
+		}
+		if done {
+			return "already ran once in this worktree", nil
+		}
+	}
+	if st.cmd.If != nil {
+		reason, err := s.unmetCondition(ctx, *st.cmd.If, session)
+		if reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	if len(st.cmd.Inputs) > 0 {
+		hash, err := hashInputs(session.Worktree, st.cmd.Inputs)
+		if err != nil {
+			return "", err
+		}
+		unchanged, err := s.state.InputsUnchanged(session.Worktree, stateKey(hookType, st.cmd), hash)
+		if err != nil {
+			return "", err
+		}
+		if unchanged {
+			return "inputs unchanged since last successful run", nil
+		}
+	}
+	return "", nil
+}
+
+// unmetCondition returns the first condition of c that does not hold.
+func (s *TerminalService) unmetCondition(ctx context.Context, c config.Condition, session Session) (string, error) {
+	resolve := func(p string) string {
+		if filepath.IsAbs(p) || session.Worktree == "" {
+			return p
+		}
+		return filepath.Join(session.Worktree, p)
+	}
+
+	if c.Exists != "" {
+		if _, err := os.Stat(resolve(c.Exists)); err != nil {
+			return fmt.Sprintf("%s does not exist", c.Exists), nil
+		}
+	}
+	if c.Missing != "" {
+		if _, err := os.Stat(resolve(c.Missing)); err == nil {
+			return fmt.Sprintf("%s exists", c.Missing), nil
+		}
+	}
+	if c.Newer != nil {
+		file, err := os.Stat(resolve(c.Newer.File))
+		if err != nil {
+			return fmt.Sprintf("%s does not exist", c.Newer.File), nil
+		}
+		than, err := os.Stat(resolve(c.Newer.Than))
+		if err == nil && !file.ModTime().After(than.ModTime()) {
+			return fmt.Sprintf("%s is not newer than %s", c.Newer.File, c.Newer.Than), nil
+		}
+	}
+	if c.Branch != "" {
+		if ok, _ := path.Match(c.Branch, session.Branch); !ok {
+			return fmt.Sprintf("branch %q does not match %q", session.Branch, c.Branch), nil
+		}
+	}
+	if c.Env != "" && lookupEnv(session.Env, c.Env) == "" {
+		return fmt.Sprintf("%s is not set", c.Env), nil
+	}
+	if c.Command != "" {
+		err := exec.RunSyncUserShellTo(ctx, c.Command, io.Discard, io.Discard, session.Env...)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return fmt.Sprintf("%q failed", c.Command), nil
+		}
+	}
+	return "", nil
+}
+
+// lookupEnv finds name in env, falling back to the process environment.
+func lookupEnv(env []string, name string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, ok := strings.Cut(env[i], "="); ok && k == name {
+			return v
+		}
+	}
+	return os.Getenv(name)
+}
+
+// stateKey identifies a command in the hook state of a worktree.
+func stateKey(hookType hook.HookType, c config.Command) string {
+	if c.Name != "" {
+		return string(hookType) + ":" + c.Name
+	}
+	return string(hookType) + ":" + c.Run
+}
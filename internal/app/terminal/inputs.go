@@ -0,0 +1,68 @@
+package terminal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// hashInputs hashes the names and contents of the files matched by globs,
+// relative to dir. A matched directory contributes every file below it.
+func hashInputs(dir string, globs []string) (string, error) {
+	seen := make(map[string]bool)
+	for _, glob := range globs {
+		pattern := glob
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", fmt.Errorf("inputs: invalid glob %q: %w", glob, err)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.Type().IsRegular() {
+					seen[path] = true
+				}
+				return nil
+			})
+			if err != nil {
+				return "", fmt.Errorf("inputs: %w", err)
+			}
+		}
+	}
+
+	files := make([]string, 0, len(seen))
+	for path := range seen {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		fmt.Fprintf(h, "%s\x00", rel)
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("inputs: %w", err)
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("inputs: %s: %w", path, err)
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,36 +1,140 @@
 package terminal
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sync"
 
+	"workforge/internal/app/config"
 	"workforge/internal/app/hook"
 	applog "workforge/internal/app/log"
+	"workforge/internal/app/state"
 	"workforge/internal/infra/exec"
 )
 
 type TerminalService struct {
 	hooks *hook.HookService
 	log   *applog.LogService
+	state *state.HookStateService
+
+	outputMu sync.Mutex
 }
 
-func NewTerminalService(hooks *hook.HookService, log *applog.LogService) *TerminalService {
-	return &TerminalService{hooks: hooks, log: log}
+func NewTerminalService(hooks *hook.HookService, log *applog.LogService, state *state.HookStateService) *TerminalService {
+	return &TerminalService{hooks: hooks, log: log, state: state}
 }
 
-func (s *TerminalService) RunCommands(hookType hook.HookType, commands []string, project string, pluginConfigs map[string]any) error {
-	for i, cmd := range commands {
-		s.log.Debug("terminal", "running %s command #%d: %s", hookType, i+1, cmd)
-		if err := exec.RunSyncUserShell(cmd); err != nil {
-			return s.log.Error("terminal", fmt.Errorf("%s command %d failed: %w", hookType, i+1, err))
-		}
+// Session carries what every command of a project run shares.
+type Session struct {
+	Project       string
+	Worktree      string
+	Branch        string
+	PluginConfigs map[string]any
+	Env           []string
+}
+
+// RunCommands runs a hook's commands, then notifies plugins. Commands run
+// in order except where parallel, background or depends_on say otherwise.
+// A command with a timeout is killed, with its process group, when it
+// expires. Errors are returned, not logged; the caller reports them.
+func (s *TerminalService) RunCommands(ctx context.Context, hookType hook.HookType, commands []config.Command, session Session) error {
+	steps, err := planCommands(commands)
+	if err != nil {
+		return fmt.Errorf("%s: %w", hookType, err)
+	}
+	if err := s.runSteps(ctx, hookType, steps, session); err != nil {
+		return err
 	}
 
-	payload := hook.NewPayload(project, hookType).WithConfig(pluginConfigs)
+	payload := hook.NewPayload(session.Project, hookType).WithConfig(session.PluginConfigs)
 	s.hooks.Run(payload)
 
 	return nil
 }
 
-func (s *TerminalService) RunForeground(cmd string) error {
-	return exec.RunSyncUserShell(cmd)
+// runCommand runs cmd attached to the terminal, or with its output sent to
+// stdout and stderr when they are set.
+func (s *TerminalService) runCommand(ctx context.Context, cmd config.Command, session Session, stdout, stderr io.Writer) error {
+	cmdCtx := ctx
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+	// A command with a timeout runs in its own process group so that the
+	// whole tree can be killed when it expires; it gets no stdin.
+	var err error
+	switch {
+	case stdout != nil:
+		err = exec.RunSyncUserShellTo(cmdCtx, cmd.Run, stdout, stderr, session.Env...)
+	case cmd.Timeout > 0:
+		err = exec.RunSyncUserShellTo(cmdCtx, cmd.Run, os.Stdout, os.Stderr, session.Env...)
+	default:
+		err = exec.RunSyncUserShell(cmdCtx, cmd.Run, session.Env...)
+	}
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("stopped: hook timed out")
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("interrupted")
+	case errors.Is(cmdCtx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timed out after %s", cmd.Timeout)
+	}
+	return fmt.Errorf("failed: %w", err)
+}
+
+func (s *TerminalService) RunForeground(ctx context.Context, cmd string, session Session) error {
+	return exec.RunInteractive(ctx, cmd, session.Env...)
+}
+
+// RunTask runs name after its dependencies, announcing each task to plugins
+// with on_task_start and on_task_end.
+func (s *TerminalService) RunTask(ctx context.Context, tasks map[string]config.Task, name string, session Session) error {
+	order, err := config.TaskOrder(tasks, name)
+	if err != nil {
+		return err
+	}
+	for _, taskName := range order {
+		task := tasks[taskName]
+		taskEnv := make(map[string]string, len(task.Env))
+		for k, v := range task.Env {
+			if config.IsReservedEnv(k) {
+				s.log.Warn("task", "ignoring %s from tasks.%s.env: reserved", k, taskName)
+				continue
+			}
+			taskEnv[k] = v
+		}
+		env := append(append([]string{}, session.Env...), config.EnvList(taskEnv)...)
+
+		start := hook.NewPayload(session.Project, hook.HookOnTaskStart).
+			WithTask(taskName).
+			WithConfig(session.PluginConfigs)
+		s.hooks.Run(start)
+
+		var runErr error
+		for i, cmd := range task.Commands {
+			s.log.Debug("task", "running %s command #%d: %s", taskName, i+1, cmd)
+			if err := exec.RunSyncUserShellIn(ctx, task.Dir, cmd, env...); err != nil {
+				runErr = fmt.Errorf("task %s command %d failed: %w", taskName, i+1, err)
+				break
+			}
+		}
+
+		end := hook.NewPayload(session.Project, hook.HookOnTaskEnd).
+			WithTask(taskName).
+			WithError(runErr).
+			WithConfig(session.PluginConfigs)
+		s.hooks.Run(end)
+
+		if runErr != nil {
+			return runErr
+		}
+	}
+	return nil
 }
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"workforge/internal/app"
+	"workforge/internal/app/state"
+
+	"github.com/spf13/cobra"
+)
+
+func NewCacheCmd(orchestrator *app.Orchestrator) *cobra.Command {
+	logSvc := orchestrator.Log()
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Inspect hook state recorded for inputs: and once:",
+	}
+
+	projectRoot := func(args []string) (string, error) {
+		if len(args) == 0 {
+			return "", nil
+		}
+		return orchestrator.ProjectRoot(args[0])
+	}
+
+	lsCmd := &cobra.Command{
+		Use:     "ls [project]",
+		Aliases: []string{"list"},
+		Short:   "List cached hook runs",
+		Args:    cobra.RangeArgs(0, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root, err := projectRoot(args)
+			if err != nil {
+				logSvc.Error("cache", err)
+				return
+			}
+			all, err := orchestrator.HookState().All()
+			if err != nil {
+				logSvc.Error("cache", err)
+				return
+			}
+			worktrees := make([]string, 0, len(all))
+			for worktree, ws := range all {
+				if state.Within(worktree, root) && len(ws.Inputs)+len(ws.Once) > 0 {
+					worktrees = append(worktrees, worktree)
+				}
+			}
+			if len(worktrees) == 0 {
+				fmt.Println("No cached hook runs")
+				return
+			}
+			sort.Strings(worktrees)
+			for _, worktree := range worktrees {
+				ws := all[worktree]
+				fmt.Println(worktree)
+				for _, key := range sortedKeys(ws.Inputs) {
+					in := ws.Inputs[key]
+					fmt.Printf("  %s\n    inputs %s  %s\n", key, in.Hash[:min(len(in.Hash), 12)], in.At.Local().Format("2006-01-02 15:04"))
+				}
+				for _, key := range sortedKeys(ws.Once) {
+					fmt.Printf("  %s\n    once  %s\n", key, ws.Once[key].Local().Format("2006-01-02 15:04"))
+				}
+			}
+		},
+	}
+
+	var clearOnce bool
+	clearCmd := &cobra.Command{
+		Use:   "clear [project]",
+		Short: "Forget recorded inputs: hashes so those commands run again",
+		Args:  cobra.RangeArgs(0, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root, err := projectRoot(args)
+			if err != nil {
+				logSvc.Error("cache", err)
+				return
+			}
+			cleared, err := orchestrator.HookState().Clear(root, clearOnce)
+			if err != nil {
+				logSvc.Error("cache", err)
+				return
+			}
+			sort.Strings(cleared)
+			for _, worktree := range cleared {
+				fmt.Printf("Cleared: %s\n", worktree)
+			}
+			if len(cleared) == 0 {
+				fmt.Println("Nothing to clear")
+			}
+		},
+	}
+
+	clearCmd.Flags().BoolVar(&clearOnce, "once", false, "Also forget once: runs, so those commands run again")
+
+	cacheCmd.AddCommand(lsCmd, clearCmd)
+	return cacheCmd
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
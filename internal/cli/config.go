@@ -0,0 +1,277 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"workforge/internal/app/config"
+	"workforge/internal/app/plugin"
+	"workforge/internal/infra/exec"
+	"workforge/internal/infra/log"
+
+	"github.com/spf13/cobra"
+)
+
+func NewConfigCmd(configSvc *config.ConfigService) *cobra.Command {
+	registry := plugin.NewPluginRegistryService(plugin.DefaultRegistryPath())
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect, edit and validate .wfconfig.yml",
+	}
+
+	var configFile string
+	var showInfo bool
+	validateCmd := &cobra.Command{
+		Use:   "validate [path]",
+		Short: "Report unknown keys, type errors and invalid values",
+		Args:  cobra.RangeArgs(0, 1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = fileArg(configFile)
+			}
+			path, err := resolveConfigArg(configSvc, args)
+			if err != nil {
+				log.Error("validate: %v", err)
+				os.Exit(1)
+			}
+			issues, err := configSvc.ValidateFile(path, pluginSections(registry))
+			if err != nil {
+				log.Error("validate: %v", err)
+				os.Exit(1)
+			}
+			printIssues(path, issues, showInfo)
+			if config.HasErrors(issues) {
+				os.Exit(1)
+			}
+			fmt.Printf("%s: OK\n", path)
+		},
+	}
+	validateCmd.Flags().BoolVarP(&showInfo, "verbose", "v", false, "Also report keys handled by plugins")
+
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema for .wfconfig.yml, including plugin sections",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := configSvc.JSONSchema(pluginSections(registry))
+			if err != nil {
+				log.Error("schema: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get <profile.path>",
+		Short: "Print a config value, e.g. default.tmux.windows[0]",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := resolveConfigArg(configSvc, fileArg(configFile))
+			if err != nil {
+				log.Error("get: %v", err)
+				os.Exit(1)
+			}
+			doc, err := configSvc.LoadDocument(path)
+			if err != nil {
+				log.Error("get: %v", err)
+				os.Exit(1)
+			}
+			node, err := doc.Get(args[0])
+			if err != nil {
+				log.Error("get: %v", err)
+				os.Exit(1)
+			}
+			out, err := config.FormatNode(node)
+			if err != nil {
+				log.Error("get: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println(out)
+		},
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <profile.path> <value>",
+		Short: "Set a config value (parsed as YAML), preserving comments",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := resolveConfigArg(configSvc, fileArg(configFile))
+			if err != nil {
+				log.Error("set: %v", err)
+				os.Exit(1)
+			}
+			doc, err := configSvc.LoadDocument(path)
+			if err != nil {
+				log.Error("set: %v", err)
+				os.Exit(1)
+			}
+			if err := doc.Set(args[0], args[1]); err != nil {
+				log.Error("set: %v", err)
+				os.Exit(1)
+			}
+			issues, err := configSvc.SaveDocument(path, doc, pluginSections(registry))
+			if err != nil {
+				printIssues(path, issues, false)
+				log.Error("set: %v", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Set %s in %s\n", args[0], path)
+		},
+	}
+
+	editCmd := &cobra.Command{
+		Use:   "edit",
+		Short: "Open the config in $EDITOR and validate before saving",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := resolveConfigArg(configSvc, fileArg(configFile))
+			if err != nil {
+				log.Error("edit: %v", err)
+				os.Exit(1)
+			}
+			if err := editConfig(cmd.Context(), configSvc, path, pluginSections(registry)); err != nil {
+				log.Error("edit: %v", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var initTemplate string
+	var initForce bool
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Write a starter .wfconfig.yml in the current directory",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			path, err := configSvc.WriteTemplate(".", initTemplate, initForce)
+			if err != nil {
+				log.Error("init: %v", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Wrote %s from template %q\n", path, initTemplate)
+		},
+	}
+	initCmd.Flags().StringVarP(&initTemplate, "template", "t", "default", "Template name ("+strings.Join(config.TemplateNames(), ", ")+")")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Overwrite an existing config")
+
+	configCmd.PersistentFlags().StringVarP(&configFile, "file", "f", "", "Config file or project directory (default: current directory)")
+	configCmd.AddCommand(validateCmd, schemaCmd, getCmd, setCmd, editCmd, initCmd)
+	return configCmd
+}
+
+func fileArg(file string) []string {
+	if file == "" {
+		return nil
+	}
+	return []string{file}
+}
+
+func printIssues(path string, issues []config.Issue, showInfo bool) {
+	for _, issue := range issues {
+		if issue.Severity == config.SeverityInfo && !showInfo {
+			continue
+		}
+		fmt.Printf("%s:%s\n", path, issue)
+	}
+}
+
+// editConfig edits a temporary copy so that an invalid result never
+// replaces the real file.
+func editConfig(ctx context.Context, configSvc *config.ConfigService, path string, plugins []config.PluginSection) error {
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".wfconfig-*.yml")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	if _, err := tmp.Write(original); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	for {
+		if err := exec.RunInteractive(ctx, editor+" "+shellQuote(tmpPath)); err != nil {
+			return fmt.Errorf("editor: %w", err)
+		}
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes")
+			return nil
+		}
+		issues := configSvc.Validate(edited, plugins)
+		if !config.HasErrors(issues) {
+			if err := os.WriteFile(path, edited, 0o644); err != nil {
+				return err
+			}
+			fmt.Printf("Saved %s\n", path)
+			return nil
+		}
+		printIssues(path, issues, false)
+		fmt.Print("Config is invalid. Re-open editor? [Y/n] ")
+		answer, _ := stdin.ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "n" || a == "no" {
+			return fmt.Errorf("changes discarded")
+		}
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func resolveConfigArg(configSvc *config.ConfigService, args []string) (string, error) {
+	target := "."
+	if len(args) > 0 {
+		target = args[0]
+	}
+	st, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	if !st.IsDir() {
+		return target, nil
+	}
+	return configSvc.FindConfigPath(target)
+}
+
+func pluginSections(registry *plugin.PluginRegistryService) []config.PluginSection {
+	plugins, err := registry.List()
+	if err != nil {
+		log.Warn("load plugin registry: %v", err)
+		return nil
+	}
+	var sections []config.PluginSection
+	for _, p := range plugins {
+		if p.ConfigKey == "" {
+			continue
+		}
+		sections = append(sections, config.PluginSection{
+			Key:    p.ConfigKey,
+			Plugin: p.Name,
+			Schema: p.ConfigSchema,
+		})
+	}
+	return sections
+}
@@ -1,42 +1,59 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
+	"workforge/internal/app"
+	"workforge/internal/app/hook"
 	"workforge/internal/app/plugin"
+	"workforge/internal/app/plugintest"
 	"workforge/internal/infra/log"
 
 	"github.com/spf13/cobra"
 )
 
-func NewPluginCmd() *cobra.Command {
+func NewPluginCmd(orchestrator *app.Orchestrator) *cobra.Command {
 	pluginsDir := plugin.DefaultPluginsDir()
 	registry := plugin.NewPluginRegistryService(plugin.DefaultRegistryPath())
-	installer := plugin.NewPluginInstallerService(pluginsDir, registry)
-	pluginSvc := plugin.NewPluginService(pluginsDir, plugin.DefaultSocketsDir())
+	rules := plugin.ManifestRules{Hooks: hook.HookNames(), HostMethods: app.HostMethodNames}
+	installer := plugin.NewPluginInstallerService(pluginsDir, registry, plugin.DefaultLockPath(), rules)
+	installer.SetBuildOutput(os.Stdout)
+	pluginSvc := orchestrator.Plugins()
 
 	pluginCmd := &cobra.Command{
 		Use:   "plugin",
 		Short: "Manage plugins",
 	}
 
+	var addYes bool
+	var addOpts plugin.InstallOptions
 	addCmd := &cobra.Command{
-		Use:   "add <url>",
-		Short: "Install a plugin from a git repository",
+		Use:   "add <url[@ref]|path|archive>",
+		Short: "Install a plugin from a git repository, a local directory or an archive",
+		Long:  "Install a plugin from a git URL (url@ref pins a tag or commit), a local directory or file:// URL (copied, or symlinked with --link), or a .tar.gz/.zip archive path or URL.",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			url := args[0]
-			entry, err := installer.Install(url)
+			entry, err := installer.Install(url, addOpts, approveCapabilities(addYes))
 			if err != nil {
 				log.Error("install plugin: %v", err)
 				return
 			}
 			fmt.Printf("Installed plugin: %s\n", entry.Name)
+			fmt.Printf("  Version: %s\n", pluginVersion(*entry))
 			fmt.Printf("  Config key: %s\n", entry.ConfigKey)
 			fmt.Printf("  Hooks: %s\n", strings.Join(entry.Hooks, ", "))
 		},
 	}
+	addCmd.Flags().BoolVarP(&addYes, "yes", "y", false, "Grant the requested capabilities without asking")
+	addCmd.Flags().BoolVar(&addOpts.Link, "link", false, "Symlink a local plugin directory instead of copying it")
+	addCmd.Flags().StringVar(&addOpts.SHA256, "sha256", "", "Expected sha256 checksum of an archive")
 
 	listCmd := &cobra.Command{
 		Use:     "list",
@@ -55,9 +72,21 @@ func NewPluginCmd() *cobra.Command {
 			}
 			for _, p := range plugins {
 				fmt.Printf("%s\n", p.Name)
+				fmt.Printf("  version: %s\n", pluginVersion(p))
 				fmt.Printf("  config_key: %s\n", p.ConfigKey)
 				fmt.Printf("  hooks: %s\n", strings.Join(p.Hooks, ", "))
 				fmt.Printf("  url: %s\n", p.URL)
+				if p.Granted != nil {
+					if len(p.Granted.Host) > 0 {
+						fmt.Printf("  host: %s\n", strings.Join(p.Granted.Host, ", "))
+					}
+					if len(p.Granted.Env) > 0 {
+						fmt.Printf("  env: %s\n", strings.Join(p.Granted.Env, ", "))
+					}
+					if p.Granted.Network {
+						fmt.Printf("  network: yes\n")
+					}
+				}
 			}
 		},
 	}
@@ -99,6 +128,12 @@ func NewPluginCmd() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
+			// Stop it first: removing its files does not stop a running
+			// plugin, and a later run would find its socket gone.
+			if err := pluginSvc.Kill(name); err != nil {
+				log.Error("stop plugin: %v", err)
+				return
+			}
 			if err := installer.Uninstall(name); err != nil {
 				log.Error("remove plugin: %v", err)
 				return
@@ -107,19 +142,21 @@ func NewPluginCmd() *cobra.Command {
 		},
 	}
 
+	var registerYes bool
 	registerCmd := &cobra.Command{
 		Use:   "register <name>",
 		Short: "Register an existing plugin directory",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			if err := installer.Register(name); err != nil {
+			if err := installer.Register(name, approveCapabilities(registerYes)); err != nil {
 				log.Error("register plugin: %v", err)
 				return
 			}
 			fmt.Printf("Registered plugin: %s\n", name)
 		},
 	}
+	registerCmd.Flags().BoolVarP(&registerYes, "yes", "y", false, "Grant the requested capabilities without asking")
 
 	healthcheckCmd := &cobra.Command{
 		Use:     "healthcheck",
@@ -128,7 +165,7 @@ func NewPluginCmd() *cobra.Command {
 		Args:    cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			payload := map[string]interface{}{"project": projectNameFromCwd()}
-			results := pluginSvc.RunHook(registry, "on_healthcheck", payload)
+			results := pluginSvc.RunHook(registry, string(hook.HookOnHealthcheck), payload)
 			if len(results) == 0 {
 				fmt.Println("No plugins with healthcheck support")
 				return
@@ -140,7 +177,6 @@ func NewPluginCmd() *cobra.Command {
 					fmt.Printf("OK  %s: %s\n", name, string(r.Response))
 				}
 			}
-			pluginSvc.KillAll()
 		},
 	}
 
@@ -191,6 +227,312 @@ func NewPluginCmd() *cobra.Command {
 		},
 	}
 
-	pluginCmd.AddCommand(addCmd, listCmd, rmCmd, registerCmd, healthcheckCmd, runCmd, killCmd)
+	var updateYes bool
+	updateCmd := &cobra.Command{
+		Use:   "update [name[@<tag|commit>]...]",
+		Short: "Update plugins installed from git and show their new commits",
+		Long:  "Update plugins installed from git to their pinned tag or commit, or to the latest commit of the default branch. name@ref pins a plugin to another tag or commit.",
+		Run: func(cmd *cobra.Command, args []string) {
+			updates, err := installer.Update(args, approveCapabilities(updateYes))
+			for _, u := range updates {
+				fmt.Printf("Updated %s %s -> %s", u.Name, shortCommit(u.From), shortCommit(u.To))
+				if u.Version != "" {
+					fmt.Printf(" (%s)", u.Version)
+				}
+				fmt.Println()
+				for _, line := range u.Changelog {
+					fmt.Printf("  %s\n", line)
+				}
+			}
+			if err != nil {
+				log.Error("update plugins: %v", err)
+				return
+			}
+			if len(updates) == 0 {
+				fmt.Println("All plugins are up to date")
+			}
+		},
+	}
+	updateCmd.Flags().BoolVarP(&updateYes, "yes", "y", false, "Grant new capabilities without asking")
+
+	outdatedCmd := &cobra.Command{
+		Use:   "outdated",
+		Short: "List plugins whose repository has newer commits",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			outdated, err := installer.Outdated()
+			if err != nil {
+				log.Error("check plugins: %v", err)
+				return
+			}
+			if len(outdated) == 0 {
+				fmt.Println("All plugins are up to date")
+				return
+			}
+			for _, o := range outdated {
+				pin := ""
+				if o.Ref != "" {
+					pin = fmt.Sprintf(" (pinned to %s)", o.Ref)
+				}
+				latest := shortCommit(o.Latest)
+				if o.LatestTag != "" {
+					latest = fmt.Sprintf("%s (%s)", o.LatestTag, latest)
+				}
+				fmt.Printf("%s %s -> %s, %d commit(s) behind%s\n", o.Name, shortCommit(o.Current), latest, o.Behind, pin)
+			}
+		},
+	}
+
+	var syncYes bool
+	syncCmd := &cobra.Command{
+		Use:   "sync [lockfile]",
+		Short: "Install plugins at the commits recorded in plugins.lock",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := plugin.DefaultLockPath()
+			if len(args) == 1 {
+				path = args[0]
+			}
+			changed, err := installer.Sync(path, approveCapabilities(syncYes))
+			for _, name := range changed {
+				fmt.Printf("Synced plugin: %s\n", name)
+			}
+			if err != nil {
+				log.Error("sync plugins: %v", err)
+				return
+			}
+			if len(changed) == 0 {
+				fmt.Println("Plugins match the lockfile")
+			}
+		},
+	}
+	syncCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "Grant the requested capabilities without asking")
+
+	validateCmd := &cobra.Command{
+		Use:   "validate [dir]",
+		Short: "Check a plugin's plugin.json",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				log.Error("validate: %v", err)
+				os.Exit(1)
+			}
+			// Installed plugins are started from the directory named after
+			// them; a source tree elsewhere may be named freely.
+			name := ""
+			if filepath.Dir(abs) == filepath.Clean(pluginsDir) {
+				name = filepath.Base(abs)
+			}
+			manifest, issues := plugin.ValidateManifest(abs, name, rules)
+			for _, issue := range issues {
+				fmt.Printf("%s: %s\n", filepath.Join(dir, "plugin.json"), issue)
+			}
+			if plugin.HasManifestErrors(issues) {
+				os.Exit(1)
+			}
+			fmt.Printf("%s: OK (%s)\n", filepath.Join(dir, "plugin.json"), manifest.Name)
+		},
+	}
+
+	var newLang, newDir string
+	var newHooks []string
+	newCmd := &cobra.Command{
+		Use:   "new <name>",
+		Short: "Create a plugin skeleton",
+		Long:  "Create a plugin directory with plugin.json, an entrypoint implementing the socket protocol with a handler per hook, and a README.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			dir := newDir
+			if dir == "" {
+				dir = name
+			}
+			if err := plugin.Scaffold(dir, name, newLang, newHooks, rules); err != nil {
+				log.Error("new plugin: %v", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Created plugin %s in %s\n", name, dir)
+			fmt.Printf("  Test it:    wf plugin test %s\n", dir)
+			fmt.Printf("  Install it: wf plugin add %s --link\n", dir)
+		},
+	}
+	newCmd.Flags().StringVar(&newLang, "lang", plugin.LangPython, "Language: "+strings.Join(plugin.ScaffoldLangs, ", "))
+	newCmd.Flags().StringVar(&newDir, "dir", "", "Directory to create (default: ./<name>)")
+	newCmd.Flags().StringSliceVar(&newHooks, "hooks", []string{string(hook.HookOnLoad), string(hook.HookOnHealthcheck)}, "Hooks to handle")
+
+	testCmd := &cobra.Command{
+		Use:   "test [dir]",
+		Short: "Start a plugin in isolation and send it every hook it declares",
+		Long:  "Build and start the plugin in dir in a temporary plugins and sockets dir, send each declared hook with a sample payload, and check its ping, notification and shutdown handling and response times.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			if err := plugintest.Run(dir, rules, orchestrator.HostMethods()); err != nil {
+				if !errors.Is(err, plugintest.ErrFailed) {
+					log.Error("test plugin: %v", err)
+				}
+				os.Exit(1)
+			}
+		},
+	}
+
+	psCmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List running plugin processes",
+		Long:  "List the plugin processes recorded in the sockets dir, whichever wf process started them, with their pid, lifecycle, uptime, time since last use and memory.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			running := pluginSvc.Running()
+			if len(running) == 0 {
+				fmt.Println("No running plugins")
+				return
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tPID\tLIFECYCLE\tUPTIME\tIDLE\tMEMORY")
+			for _, p := range running {
+				idle := formatAge(p.LastUsed)
+				if p.IdleTimeout > 0 {
+					idle += "/" + formatDuration(p.IdleTimeout)
+				}
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", p.Name, p.PID, p.Lifecycle, formatAge(p.Started), idle, formatMemory(p.Memory))
+			}
+			w.Flush()
+		},
+	}
+
+	var logsFollow bool
+	var logsLines int
+	logsCmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Show a plugin's output",
+		Long:  "Show the last lines a plugin wrote to stdout and stderr, along with its starts, crashes and restarts. -f keeps printing new output.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := args[0]
+			if _, ok := registry.Find(name); !ok {
+				log.Error("plugin %s is not installed", name)
+				os.Exit(1)
+			}
+			path := pluginSvc.LogPath(name)
+			err := plugin.TailLog(path, logsLines, os.Stdout)
+			switch {
+			case os.IsNotExist(err) && !logsFollow:
+				fmt.Printf("No output from %s yet (%s)\n", name, path)
+				return
+			case err != nil && !os.IsNotExist(err):
+				log.Error("plugin logs: %v", err)
+				os.Exit(1)
+			}
+			if logsFollow {
+				if err := plugin.FollowLog(cmd.Context(), path, os.Stdout); err != nil {
+					log.Error("plugin logs: %v", err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+	logsCmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Keep printing new output")
+	logsCmd.Flags().IntVarP(&logsLines, "lines", "n", 50, "Number of lines to show")
+
+	pluginCmd.AddCommand(addCmd, listCmd, rmCmd, registerCmd, updateCmd, outdatedCmd, syncCmd, validateCmd, newCmd, testCmd, healthcheckCmd, runCmd, killCmd, psCmd, logsCmd)
 	return pluginCmd
 }
+
+// approveCapabilities shows what a plugin requests and asks the user to
+// grant it. When the plugin was granted capabilities before, only the new
+// ones are listed. yes grants without asking.
+func approveCapabilities(yes bool) plugin.Approver {
+	return func(name string, requested plugin.Capabilities, granted *plugin.Capabilities) bool {
+		shown := requested
+		if granted != nil {
+			fmt.Printf("Plugin %s requests additional capabilities:\n", name)
+			shown = requested.Missing(*granted)
+		} else {
+			fmt.Printf("Plugin %s requests:\n", name)
+		}
+		printCapabilities(shown)
+		fmt.Println("  It runs as a local process with your user's permissions.")
+		if yes {
+			return true
+		}
+		fmt.Print("Grant these capabilities? [y/N] ")
+		answer, err := stdin.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Println("\nNo answer; pass --yes to grant them")
+			return false
+		}
+		a := strings.ToLower(strings.TrimSpace(answer))
+		return a == "y" || a == "yes"
+	}
+}
+
+func printCapabilities(c plugin.Capabilities) {
+	none := func(items []string) string {
+		if len(items) == 0 {
+			return "none"
+		}
+		return strings.Join(items, ", ")
+	}
+	fmt.Printf("  hooks: %s\n", none(c.Hooks))
+	fmt.Printf("  host methods: %s\n", none(c.Host))
+	fmt.Printf("  env: %s\n", none(c.Env))
+	if c.Network {
+		fmt.Println("  network: yes")
+	} else {
+		fmt.Println("  network: no")
+	}
+}
+
+func pluginVersion(p plugin.PluginEntry) string {
+	version := p.Version
+	if version == "" {
+		version = "unversioned"
+	}
+	if p.Commit != "" {
+		version += " @" + shortCommit(p.Commit)
+	}
+	if p.Ref != "" {
+		version += " (pinned to " + p.Ref + ")"
+	}
+	return version
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// formatAge renders the time since t rounded to the second.
+func formatAge(t time.Time) string {
+	return formatDuration(time.Since(t).Round(time.Second))
+}
+
+// formatDuration renders d like time.Duration without trailing zero
+// units: 10m rather than 10m0s.
+func formatDuration(d time.Duration) string {
+	out := d.String()
+	if strings.HasSuffix(out, "m0s") {
+		out = strings.TrimSuffix(out, "0s")
+	}
+	if strings.HasSuffix(out, "h0m") {
+		out = strings.TrimSuffix(out, "0m")
+	}
+	return out
+}
+
+func formatMemory(bytes int64) string {
+	if bytes < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f MiB", float64(bytes)/(1<<20))
+}
@@ -1,15 +1,31 @@
 package cli
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"workforge/internal/app"
+	"workforge/internal/app/config"
 	"workforge/internal/app/project"
+	"workforge/internal/infra/exec"
 
 	"github.com/spf13/cobra"
 )
 
+// stdin is shared by every prompt, so input buffered while reading one
+// answer is not lost to the next.
+var stdin = bufio.NewReader(os.Stdin)
+
+// exitCode is what wf exits with after a command that failed. Commands set
+// it instead of calling os.Exit, so that Execute still cleans up.
+var exitCode int
+
 func Execute() {
 	orchestrator := app.NewOrchestrator()
 	logSvc := orchestrator.Log()
@@ -49,12 +65,12 @@ func Execute() {
 				path = filepath.Join(path, args[0])
 			}
 			if loadProfile != "" {
-				if err := orchestrator.LoadProject(path, false, &loadProfile, ""); err != nil {
+				if err := orchestrator.LoadProject(cmd.Context(), path, false, &loadProfile, ""); err != nil {
 					logSvc.Error("load", err)
 				}
 				return
 			}
-			if err := orchestrator.LoadProject(path, false, nil, ""); err != nil {
+			if err := orchestrator.LoadProject(cmd.Context(), path, false, nil, ""); err != nil {
 				logSvc.Error("load", err)
 			}
 		},
@@ -78,6 +94,7 @@ func Execute() {
 	}
 
 	var openProfile string
+	var openExplain bool
 	var openCmd = &cobra.Command{
 		Use:   "open <project-name>",
 		Short: "Open a Workforge project",
@@ -93,17 +110,25 @@ func Execute() {
 			if openProfile != "" {
 				profile = &openProfile
 			}
-			if err := orchestrator.LoadProject(entry.Path, entry.IsGWT, profile, entry.Name); err != nil {
+			if openExplain {
+				selection, err := orchestrator.ExplainProfile(entry.Path, entry.IsGWT, profile)
+				printProfileSelection(selection, err)
+				if err != nil {
+					return
+				}
+			}
+			if err := orchestrator.LoadProject(cmd.Context(), entry.Path, entry.IsGWT, profile, entry.Name); err != nil {
 				logSvc.Error("open", err)
 			}
 		},
 	}
 	openCmd.Flags().StringVarP(&openProfile, "profile", "p", "", "Profile name to use")
+	openCmd.Flags().BoolVar(&openExplain, "explain", false, "Show why a profile was chosen")
 
 	var closeProfile string
 	var closeCmd = &cobra.Command{
 		Use:   "close <project-name>",
-		Short: "Close a project (kills tmux session and runs on_close hooks)",
+		Short: "Close a project (runs on_close hooks, stops background commands, kills tmux session)",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
@@ -111,14 +136,37 @@ func Execute() {
 			if closeProfile != "" {
 				profile = &closeProfile
 			}
-			if err := orchestrator.CloseProject(name, profile); err != nil {
+			if err := orchestrator.CloseProject(cmd.Context(), name, profile); err != nil {
 				logSvc.Error("close", err)
 			}
 		},
 	}
 	closeCmd.Flags().StringVarP(&closeProfile, "profile", "p", "", "Profile name to use")
 
-	rootCmd.AddCommand(initCmd, loadCmd, listCmd, openCmd, closeCmd)
+	var envProfile string
+	var envCmd = &cobra.Command{
+		Use:   "env <project-name>",
+		Short: "Print the resolved project environment in shell-export format",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var profile *string
+			if envProfile != "" {
+				profile = &envProfile
+			}
+			env, err := orchestrator.ProjectEnv(args[0], profile)
+			if err != nil {
+				logSvc.Error("env", err)
+				return
+			}
+			for _, kv := range env {
+				k, v, _ := strings.Cut(kv, "=")
+				fmt.Printf("export %s=%s\n", k, shellQuote(v))
+			}
+		},
+	}
+	envCmd.Flags().StringVarP(&envProfile, "profile", "p", "", "Profile name to use")
+
+	rootCmd.AddCommand(initCmd, loadCmd, listCmd, openCmd, closeCmd, envCmd)
 
 	var addCmd = &cobra.Command{
 		Use:   "add [worktree] <branch>",
@@ -153,7 +201,7 @@ func Execute() {
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			name := args[0]
-			leafPath, err := orchestrator.RemoveWorktree(name)
+			leafPath, err := orchestrator.RemoveWorktree(cmd.Context(), name)
 			if err != nil {
 				if _, ok := err.(project.WorktreeNotFoundError); ok {
 					logSvc.Warn("remove worktree", "could not locate worktree directory for: %s", name)
@@ -166,6 +214,55 @@ func Execute() {
 		},
 	}
 	rootCmd.AddCommand(rmCmd)
-	rootCmd.AddCommand(NewPluginCmd())
-	rootCmd.Execute()
+	rootCmd.AddCommand(NewPluginCmd(orchestrator))
+	rootCmd.AddCommand(NewConfigCmd(orchestrator.Config()))
+	rootCmd.AddCommand(NewTaskCmd(orchestrator))
+	rootCmd.AddCommand(NewCacheCmd(orchestrator))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := handleInterrupts(cancel, orchestrator)
+	rootCmd.ExecuteContext(ctx)
+	if ctx.Err() == nil {
+		orchestrator.Close()
+	}
+	// The handler cancels ctx before cleaning up; let it finish.
+	if ctx.Err() != nil {
+		<-interrupted
+		os.Exit(130)
+	}
+	os.Exit(exitCode)
+}
+
+// handleInterrupts cancels running commands and stops plugins on SIGTERM or
+// on a SIGINT that isn't meant for an interactive child (e.g. Ctrl-C inside
+// the foreground editor). The returned channel is closed once cleanup is done.
+func handleInterrupts(cancel context.CancelFunc, orchestrator *app.Orchestrator) <-chan struct{} {
+	done := make(chan struct{})
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range sigCh {
+			if sig == os.Interrupt && exec.InteractiveRunning() {
+				continue
+			}
+			break
+		}
+		signal.Stop(sigCh)
+		cancel()
+		orchestrator.Interrupt()
+		close(done)
+	}()
+	return done
+}
+
+func printProfileSelection(selection config.ProfileSelection, err error) {
+	for _, d := range selection.Details {
+		fmt.Printf("  %s\n", d)
+	}
+	if err != nil {
+		fmt.Printf("No profile selected: %v\n", err)
+		return
+	}
+	fmt.Printf("Profile %s: %s\n", selection.Name, selection.Reason)
 }
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+
+	"workforge/internal/app"
+	"workforge/internal/app/config"
+
+	"github.com/spf13/cobra"
+)
+
+func NewTaskCmd(orchestrator *app.Orchestrator) *cobra.Command {
+	logSvc := orchestrator.Log()
+
+	var taskProfile string
+	var listTasks bool
+	taskCmd := &cobra.Command{
+		Use:     "task <name> [project-name]",
+		Aliases: []string{"run"},
+		Short:   "Run a named task from .wfconfig.yml",
+		Args:    cobra.RangeArgs(0, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var profile *string
+			if taskProfile != "" {
+				profile = &taskProfile
+			}
+
+			if listTasks {
+				projectName := ""
+				if len(args) > 0 {
+					projectName = args[0]
+				}
+				tasks, err := orchestrator.ListTasks(projectName, profile)
+				if err != nil {
+					logSvc.Error("task", err)
+					return
+				}
+				if len(tasks) == 0 {
+					fmt.Println("No tasks defined")
+					return
+				}
+				for _, name := range config.TaskNames(tasks) {
+					task := tasks[name]
+					fmt.Printf("%s\n", name)
+					if task.Description != "" {
+						fmt.Printf("  %s\n", task.Description)
+					}
+					if len(task.DependsOn) > 0 {
+						fmt.Printf("  depends on: %v\n", task.DependsOn)
+					}
+				}
+				return
+			}
+
+			if len(args) == 0 {
+				cmd.Usage()
+				return
+			}
+			projectName := ""
+			if len(args) > 1 {
+				projectName = args[1]
+			}
+			if err := orchestrator.RunTask(cmd.Context(), args[0], projectName, profile); err != nil {
+				logSvc.Error("task", err)
+				exitCode = 1
+			}
+		},
+	}
+	taskCmd.Flags().StringVarP(&taskProfile, "profile", "p", "", "Profile name to use")
+	taskCmd.Flags().BoolVarP(&listTasks, "list", "l", false, "List tasks (optionally for [project-name])")
+	return taskCmd
+}
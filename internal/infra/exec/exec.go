@@ -2,9 +2,16 @@ package exec
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"os"
 	osexec "os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 func RunSyncCommand(name string, args ...string) error {
@@ -38,28 +45,182 @@ func RunOutput(name string, args ...string) (string, error) {
 	return string(bytes.TrimSpace(out.Bytes())), nil
 }
 
-func RunSyncUserShell(cmdline string) error {
-	cmd := userShellCommandLinux(cmdline)
-	cmd.Env = os.Environ()
+// killGrace is how long a cancelled command gets between SIGTERM and SIGKILL.
+const killGrace = 3 * time.Second
+
+// RunSyncUserShell runs cmdline in the user's shell with the current
+// environment plus env ("KEY=VALUE"); later entries win. The command is
+// stopped when ctx is done.
+func RunSyncUserShell(ctx context.Context, cmdline string, env ...string) error {
+	return RunSyncUserShellIn(ctx, "", cmdline, env...)
+}
+
+// RunSyncUserShellIn is RunSyncUserShell with a working directory; an empty
+// dir keeps the current one. Like a shell's foreground job, the command
+// stays in the terminal's foreground process group with stdin attached, so
+// prompts such as sudo or read work and Ctrl-C reaches it from the terminal.
+func RunSyncUserShellIn(ctx context.Context, dir string, cmdline string, env ...string) error {
+	cmd := foregroundCommand(ctx, cmdline)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
-func RunAsyncUserShell(cmdline string) (*osexec.Cmd, error) {
-	cmd := userShellCommandLinux(cmdline)
-	cmd.Env = os.Environ()
+// RunSyncUserShellTo is RunSyncUserShell with its output sent to stdout and
+// stderr and no stdin, for commands that run alongside others or have a
+// timeout. The command runs in its own process group so that cancelling
+// ctx stops all of it.
+func RunSyncUserShellTo(ctx context.Context, cmdline string, stdout, stderr io.Writer, env ...string) error {
+	cmd := userShellCommand(ctx, cmdline)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+var interactive atomic.Int32
+
+// RunInteractive runs cmdline attached to the terminal. Like a shell with a
+// foreground job, the child stays in the terminal's foreground process
+// group and wf leaves Ctrl-C to it while it runs; see InteractiveRunning.
+func RunInteractive(ctx context.Context, cmdline string, env ...string) error {
+	interactive.Add(1)
+	defer interactive.Add(-1)
+	cmd := foregroundCommand(ctx, cmdline)
+	cmd.Env = append(os.Environ(), env...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func InteractiveRunning() bool {
+	return interactive.Load() > 0
+}
+
+// foregroundCommand binds a command that shares wf's process group to ctx.
+// Ctrl-C already reaches the whole group from the terminal, so cancelling
+// only sends SIGTERM to the shell, and SIGKILL if it outlives the grace
+// period.
+func foregroundCommand(ctx context.Context, cmdline string) *osexec.Cmd {
+	cmd := userShellCommandLinux(ctx, cmdline)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = killGrace
+	return cmd
+}
+
+// RunAsyncUserShell starts cmdline in its own process group, like a shell
+// background job, so Ctrl-C does not reach it; stop it with
+// KillProcessGroup. The caller must Wait for it.
+func RunAsyncUserShell(ctx context.Context, cmdline string, stdout, stderr io.Writer, env ...string) (*osexec.Cmd, error) {
+	cmd := userShellCommand(ctx, cmdline)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
 	return cmd, nil
 }
 
-func userShellCommandLinux(cmdline string) *osexec.Cmd {
+// StartDetachedUserShell starts cmdline in a session of its own with its
+// output appended to logPath, so it keeps running after wf exits and no
+// terminal signal reaches it. Stop it with KillProcessGroup. ctx bounds it
+// only while wf runs; the caller must Wait for it.
+func StartDetachedUserShell(ctx context.Context, cmdline, logPath string, env ...string) (*osexec.Cmd, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	cmd := userShellCommand(ctx, cmdline)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// ProcessStart identifies the process pid across PID reuse and reboots:
+// the boot id and the process's start time in clock ticks since boot, both
+// from /proc. It is empty when pid is not running or /proc is unavailable.
+func ProcessStart(pid int) string {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ""
+	}
+	// The command name in parentheses may contain spaces; the fields
+	// after it start with the state, field 3, so starttime, field 22, is
+	// the 20th.
+	end := bytes.LastIndexByte(stat, ')')
+	if end < 0 {
+		return ""
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return ""
+	}
+	bootID, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(bootID)) + ":" + fields[19]
+}
+
+// SameProcess reports whether pid is still the process ProcessStart
+// returned start for. An empty start matches nothing.
+func SameProcess(pid int, start string) bool {
+	return pid > 0 && start != "" && ProcessStart(pid) == start
+}
+
+// userShellCommand binds the command to ctx. It runs in its own process
+// group so that cancelling ctx stops the whole tree, grandchildren such as
+// npm or docker included. Cancel returns, and so Wait returns, only once
+// the group is gone; WaitDelay bounds waiting for its output after that.
+func userShellCommand(ctx context.Context, cmdline string) *osexec.Cmd {
+	cmd := userShellCommandLinux(ctx, cmdline)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return KillProcessGroup(cmd.Process.Pid)
+	}
+	cmd.WaitDelay = killGrace + time.Second
+	return cmd
+}
+
+// KillProcessGroup sends SIGTERM to the group led by pid and SIGKILL to
+// whatever is left of it after a grace period. It returns once the group
+// is gone.
+func KillProcessGroup(pid int) error {
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	deadline := time.Now().Add(killGrace)
+	for time.Now().Before(deadline) {
+		if syscall.Kill(-pid, 0) == syscall.ESRCH {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	syscall.Kill(-pid, syscall.SIGKILL)
+	return nil
+}
+
+func userShellCommandLinux(ctx context.Context, cmdline string) *osexec.Cmd {
 	shell := os.Getenv("SHELL")
 	if shell == "" {
 		shell = "/bin/sh"
@@ -68,14 +229,14 @@ func userShellCommandLinux(cmdline string) *osexec.Cmd {
 
 	switch name {
 	case "bash":
-		return osexec.Command(shell, "-lc", cmdline)
+		return osexec.CommandContext(ctx, shell, "-lc", cmdline)
 	case "zsh":
-		return osexec.Command(shell, "-lc", cmdline)
+		return osexec.CommandContext(ctx, shell, "-lc", cmdline)
 	case "fish":
-		return osexec.Command(shell, "-lc", cmdline)
+		return osexec.CommandContext(ctx, shell, "-lc", cmdline)
 	case "dash", "sh":
-		return osexec.Command(shell, "-c", cmdline)
+		return osexec.CommandContext(ctx, shell, "-c", cmdline)
 	default:
-		return osexec.Command(shell, "-c", cmdline)
+		return osexec.CommandContext(ctx, shell, "-c", cmdline)
 	}
 }
@@ -40,6 +40,29 @@ func (r *PathResolver) RegistryPath() (string, error) {
 	return filepath.Join(configDir, "workforge.json"), nil
 }
 
+// HookStatePath is where per-worktree hook state such as `once:` runs is
+// kept.
+func (r *PathResolver) HookStatePath() (string, error) {
+	configDir, err := r.WorkforgeConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "hook-state.json"), nil
+}
+
+// StateDir is where logs and other runtime files are kept:
+// $XDG_STATE_HOME/workforge, ~/.local/state/workforge by default.
+func (r *PathResolver) StateDir() (string, error) {
+	if stateDir := os.Getenv("XDG_STATE_HOME"); stateDir != "" {
+		return filepath.Join(stateDir, "workforge"), nil
+	}
+	homeDir, err := r.userHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "state", "workforge"), nil
+}
+
 func (r *PathResolver) NormalizePath(path string) (string, error) {
 	if path == "" {
 		return "", fmt.Errorf("path is empty")
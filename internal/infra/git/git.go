@@ -72,6 +72,19 @@ func GitCurrentBranchForPath(repoPath string) (string, error) {
 	return strings.TrimSpace(out), nil
 }
 
+// GitStatus returns the porcelain status lines of the worktree at repoPath;
+// the first line is the "## branch...upstream" header.
+func GitStatus(repoPath string) ([]string, error) {
+	out, err := execinfra.RunOutput("git", "-C", repoPath, "status", "--porcelain=v1", "--branch")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git status: %w", err)
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
 func worktreeFolderName(name string) string {
 	return filepath.Join("..", worktreeLeafName(name))
 }
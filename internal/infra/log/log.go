@@ -26,24 +26,31 @@ var currentLevel = LevelInfo
 
 func SetLogLevel(l LogLevel) { currentLevel = l }
 
-func SetLogLevelFromString(s string) {
+// LevelNames lists the accepted log_level spellings.
+var LevelNames = []string{"DEBUG", "INFO", "WARN", "WARNING", "ERROR", "SILENT", "QUIET"}
+
+func ParseLogLevel(s string) (LogLevel, bool) {
 	s = strings.TrimSpace(strings.ToUpper(s))
 	switch s {
 	case "", "INFO":
-		currentLevel = LevelInfo
+		return LevelInfo, true
 	case "DEBUG":
-		currentLevel = LevelDebug
+		return LevelDebug, true
 	case "WARN", "WARNING":
-		currentLevel = LevelWarn
+		return LevelWarn, true
 	case "ERROR":
-		currentLevel = LevelError
+		return LevelError, true
 	case "SILENT", "QUIET":
-		currentLevel = LevelSilent
+		return LevelSilent, true
 	default:
-		currentLevel = LevelInfo
+		return LevelInfo, false
 	}
 }
 
+func SetLogLevelFromString(s string) {
+	currentLevel, _ = ParseLogLevel(s)
+}
+
 const (
 	colReset   = "\x1b[0m"
 	colDim     = "\x1b[2m"
@@ -6,8 +6,15 @@ import (
 
 type WindowCallback func(session string, windowIndex int, command string)
 
-func NewSession(path string, sessionName string, attach bool, windows []string, onWindow WindowCallback) error {
-	if err := execinfra.RunSyncCommand("tmux", "new-session", "-s", sessionName, "-d"); err != nil {
+// NewSession creates a detached session and runs one command per window.
+// env ("KEY=VALUE") is set in the session environment so every window
+// inherits it.
+func NewSession(path string, sessionName string, attach bool, windows []string, env []string, onWindow WindowCallback) error {
+	args := []string{"new-session", "-s", sessionName, "-d"}
+	for _, kv := range env {
+		args = append(args, "-e", kv)
+	}
+	if err := execinfra.RunSyncCommand("tmux", args...); err != nil {
 		return err
 	}
 	if err := execinfra.RunSyncCommand("tmux", "send-keys", "-t", sessionName, windows[0], "C-m"); err != nil {
@@ -40,6 +47,16 @@ func KillSession(sessionName string) error {
 }
 
 func HasSession(sessionName string) bool {
-	err := execinfra.RunSyncCommand("tmux", "has-session", "-t", sessionName)
+	_, err := execinfra.RunOutput("tmux", "has-session", "-t", sessionName)
 	return err == nil
 }
+
+// SendKeys types keys into the tmux pane target, followed by Enter when
+// enter is set.
+func SendKeys(target string, keys string, enter bool) error {
+	args := []string{"send-keys", "-t", target, keys}
+	if enter {
+		args = append(args, "Enter")
+	}
+	return execinfra.RunSyncCommand("tmux", args...)
+}
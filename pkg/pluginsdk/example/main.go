@@ -0,0 +1,64 @@
+// Command sdk-example is a workforge plugin built with pluginsdk. It greets
+// on on_load, protects branches listed in its config from pre_open and
+// logs every message.
+//
+//	sdk_example:
+//	  greeting: Welcome back
+//	  protect: [main]
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"workforge/pkg/pluginsdk"
+)
+
+type config struct {
+	Greeting string   `json:"greeting"`
+	Protect  []string `json:"protect"`
+}
+
+func loadConfig(p *pluginsdk.Payload) (config, error) {
+	cfg := config{Greeting: "Hello"}
+	err := p.DecodeConfig(&cfg)
+	return cfg, err
+}
+
+func main() {
+	p := pluginsdk.New("sdk-example")
+
+	p.Handle(pluginsdk.HookOnLoad, func(ctx context.Context, pl *pluginsdk.Payload) (*pluginsdk.Response, error) {
+		cfg, err := loadConfig(pl)
+		if err != nil {
+			return nil, err
+		}
+		return pluginsdk.Message(fmt.Sprintf("%s, %s", cfg.Greeting, pl.Project)), nil
+	})
+
+	p.Handle(pluginsdk.HookPreOpen, func(ctx context.Context, pl *pluginsdk.Payload) (*pluginsdk.Response, error) {
+		cfg, err := loadConfig(pl)
+		if err != nil {
+			return nil, err
+		}
+		branch := pl.String(pluginsdk.FieldBranch)
+		if slices.Contains(cfg.Protect, branch) {
+			return pluginsdk.Abort(branch + " is protected"), nil
+		}
+		return &pluginsdk.Response{Env: map[string]string{"SDK_EXAMPLE_BRANCH": branch}}, nil
+	})
+
+	p.Handle(pluginsdk.HookOnMessage, func(ctx context.Context, pl *pluginsdk.Payload) (*pluginsdk.Response, error) {
+		p.Logger.Printf("message: %s", pl.String(pluginsdk.FieldMessage))
+		return nil, nil
+	})
+
+	p.Handle(pluginsdk.HookOnHealthcheck, func(ctx context.Context, pl *pluginsdk.Payload) (*pluginsdk.Response, error) {
+		return pluginsdk.Message("ok"), nil
+	})
+
+	if err := p.Run(); err != nil {
+		p.Logger.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+package pluginsdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Methods of the workforge host endpoint. A plugin may only call those
+// listed under capabilities.host in its plugin.json.
+const (
+	HostProjectsList  = "projects.list"
+	HostConfigResolve = "config.resolve"
+	HostGitStatus     = "git.status"
+	HostLogWrite      = "log.write"
+	HostTmuxSendKeys  = "tmux.sendKeys"
+)
+
+// ErrNoHost is returned by Host when workforge did not pass a host socket,
+// because the plugin was granted no host methods.
+var ErrNoHost = errors.New("no host socket; declare host methods under capabilities.host")
+
+const hostCallTimeout = 30 * time.Second
+
+// Host calls back into workforge. Calls are serialized.
+type Host struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	enc    *json.Encoder
+	dec    *json.Decoder
+	nextID int
+}
+
+// Host connects to the workforge host endpoint.
+func (p *Plugin) Host() (*Host, error) {
+	path := os.Getenv(HostSocketEnv)
+	if len(os.Args) > 2 {
+		path = os.Args[2]
+	}
+	if path == "" {
+		return nil, ErrNoHost
+	}
+	conn, err := net.DialTimeout("unix", path, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect to host: %w", err)
+	}
+	return &Host{conn: conn, enc: json.NewEncoder(conn), dec: json.NewDecoder(conn)}, nil
+}
+
+// Call invokes method with params and decodes its result into result,
+// which may be nil.
+func (h *Host) Call(method string, params, result any) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	id := h.nextID
+	h.conn.SetDeadline(time.Now().Add(hostCallTimeout))
+	req := map[string]any{"jsonrpc": "2.0", "id": id, "method": method}
+	if params != nil {
+		req["params"] = params
+	}
+	if err := h.enc.Encode(req); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	var resp struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	if err := h.dec.Decode(&resp); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s: %w", method, resp.Error)
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Log prints message through the workforge logger at level, one of
+// "debug", "info", "warn" or "error".
+func (h *Host) Log(level, message string) error {
+	return h.Call(HostLogWrite, map[string]string{"level": level, "message": message}, nil)
+}
+
+// Close closes the connection to workforge.
+func (h *Host) Close() error {
+	return h.conn.Close()
+}
@@ -0,0 +1,105 @@
+package pluginsdk
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// HookType names a workforge hook. The values match the hook types of
+// workforge itself.
+type HookType string
+
+const (
+	HookOnLoad             HookType = "on_load"
+	HookOnClose            HookType = "on_close"
+	HookOnCreate           HookType = "on_create"
+	HookOnDelete           HookType = "on_delete"
+	HookOnShellRunIn       HookType = "on_shell_run_in"
+	HookOnShellRunOut      HookType = "on_shell_run_out"
+	HookOnPluginWakeup     HookType = "on_plugin_wakeup"
+	HookOnError            HookType = "on_error"
+	HookOnWarning          HookType = "on_warning"
+	HookOnDebug            HookType = "on_debug"
+	HookOnMessage          HookType = "on_message"
+	HookOnTmuxSessionStart HookType = "on_tmux_session_start"
+	HookOnTmuxWindow       HookType = "on_tmux_window"
+	HookOnTaskStart        HookType = "on_task_start"
+	HookOnTaskEnd          HookType = "on_task_end"
+	HookOnHealthcheck      HookType = "on_healthcheck"
+	HookPreOpen            HookType = "pre_open"
+	HookPreDelete          HookType = "pre_delete"
+)
+
+// Keys of Payload.Data set by workforge.
+const (
+	FieldError   = "error"
+	FieldWarning = "warning"
+	FieldMessage = "message"
+	FieldContext = "context"
+	FieldSource  = "source"
+	FieldSession = "session"
+	FieldWindow  = "window"
+	FieldCommand = "command"
+	FieldTask    = "task"
+	FieldPath    = "path"
+	FieldBranch  = "branch"
+	FieldProfile = "profile"
+)
+
+// Payload is what workforge sends with every hook: the project, the hook
+// type, hook-specific data and the plugin's section of .wfconfig.yml.
+type Payload struct {
+	Project string          `json:"project"`
+	Type    HookType        `json:"hook_type"`
+	Data    map[string]any  `json:"data,omitempty"`
+	Config  json.RawMessage `json:"config,omitempty"`
+}
+
+// String returns Data[key] as a string, or "" when it is missing.
+func (p *Payload) String(key string) string {
+	switch v := p.Data[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// DecodeConfig decodes the plugin's config section into v. It leaves v
+// untouched when the project has no section for the plugin.
+func (p *Payload) DecodeConfig(v any) error {
+	if len(p.Config) == 0 || string(p.Config) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(p.Config, v); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+	return nil
+}
+
+const (
+	ActionContinue = "continue"
+	ActionAbort    = "abort"
+)
+
+// Response is what a hook handler may answer. Every field is optional.
+// Action, Env and Windows are honored for pre-hooks only.
+type Response struct {
+	Action  string            `json:"action,omitempty"`
+	Reason  string            `json:"reason,omitempty"`
+	Message string            `json:"message,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Windows []string          `json:"windows,omitempty"`
+}
+
+// Message returns a response that prints msg.
+func Message(msg string) *Response {
+	return &Response{Message: msg}
+}
+
+// Abort returns a pre-hook response that vetoes the operation.
+func Abort(reason string) *Response {
+	return &Response{Action: ActionAbort, Reason: reason}
+}
@@ -0,0 +1,360 @@
+// Package pluginsdk implements the workforge plugin protocol in Go.
+//
+// A plugin registers a handler per hook and calls Run:
+//
+//	p := pluginsdk.New("notify")
+//	p.Handle(pluginsdk.HookOnLoad, func(ctx context.Context, pl *pluginsdk.Payload) (*pluginsdk.Response, error) {
+//		return pluginsdk.Message("loaded " + pl.Project), nil
+//	})
+//	if err := p.Run(); err != nil {
+//		p.Logger.Fatal(err)
+//	}
+//
+// Run listens on the socket workforge passes as the first argument,
+// answers on_ping, dispatches hooks to their handlers, concurrently and
+// possibly in batches, and returns after a shutdown request or SIGTERM
+// once running handlers are done.
+package pluginsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// HostSocketEnv names the variable holding the socket of the workforge
+// host endpoint, set when the plugin was granted host methods.
+const HostSocketEnv = "WF_HOST_SOCKET"
+
+// ShutdownTimeout is how long Run waits for running handlers on shutdown
+// before cancelling their context.
+const ShutdownTimeout = 5 * time.Second
+
+// cancelGrace is how long handlers get to return once their context is
+// cancelled before Run gives up on them.
+const cancelGrace = 2 * time.Second
+
+// Handler serves one hook. A nil response answers null.
+type Handler func(ctx context.Context, p *Payload) (*Response, error)
+
+// Plugin dispatches workforge hooks to handlers.
+type Plugin struct {
+	Name string
+	// Logger writes to stderr, which workforge keeps in the plugin's log.
+	Logger *log.Logger
+
+	handlers map[HookType]Handler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	inflight sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopping bool
+	stopped  chan struct{}
+}
+
+// New returns a plugin without handlers.
+func New(name string) *Plugin {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Plugin{
+		Name:     name,
+		Logger:   log.New(os.Stderr, "["+name+"] ", log.LstdFlags),
+		handlers: make(map[HookType]Handler),
+		conns:    make(map[net.Conn]struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Handle registers h for hook, replacing any previous handler.
+func (p *Plugin) Handle(hook HookType, h Handler) {
+	p.handlers[hook] = h
+}
+
+// Hooks returns the hooks with a handler, for listing in plugin.json.
+func (p *Plugin) Hooks() []HookType {
+	hooks := make([]HookType, 0, len(p.handlers))
+	for h := range p.handlers {
+		hooks = append(hooks, h)
+	}
+	return hooks
+}
+
+// Run serves on the socket given as the first command-line argument until
+// workforge asks the plugin to shut down or it receives SIGTERM or SIGINT.
+func (p *Plugin) Run() error {
+	if len(os.Args) < 2 {
+		return fmt.Errorf("usage: %s <socket> [host-socket]", os.Args[0])
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			p.Logger.Printf("received %s, shutting down", sig)
+			p.Shutdown()
+		case <-p.stopped:
+		}
+	}()
+	return p.Serve(os.Args[1])
+}
+
+// Serve listens on socketPath and serves until Shutdown.
+func (p *Plugin) Serve(socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	p.mu.Lock()
+	p.listener = listener
+	stopping := p.stopping
+	p.mu.Unlock()
+	if stopping {
+		listener.Close()
+	}
+	p.Logger.Printf("listening on %s", socketPath)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if p.isStopping() {
+				break
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		p.mu.Lock()
+		p.conns[conn] = struct{}{}
+		p.mu.Unlock()
+		go p.serveConn(conn)
+	}
+
+	p.drain()
+	os.Remove(socketPath)
+	p.Logger.Printf("stopped")
+	return nil
+}
+
+// Shutdown stops accepting requests. Serve returns once running handlers
+// finish, or after ShutdownTimeout with their context cancelled, at the
+// latest cancelGrace later.
+func (p *Plugin) Shutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping {
+		return
+	}
+	p.stopping = true
+	close(p.stopped)
+	if p.listener != nil {
+		p.listener.Close()
+	}
+}
+
+func (p *Plugin) isStopping() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stopping
+}
+
+// drain waits for running handlers, then closes the connections.
+func (p *Plugin) drain() {
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(ShutdownTimeout):
+		p.Logger.Printf("handlers still running after %s, cancelling", ShutdownTimeout)
+		p.cancel()
+		select {
+		case <-done:
+		case <-time.After(cancelGrace):
+			p.Logger.Printf("handlers ignored cancellation for %s, stopping anyway", cancelGrace)
+		}
+	}
+	p.cancel()
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+}
+
+func (p *Plugin) serveConn(conn net.Conn) {
+	defer func() {
+		p.mu.Lock()
+		delete(p.conns, conn)
+		p.mu.Unlock()
+		conn.Close()
+	}()
+
+	var writeMu sync.Mutex
+	write := func(v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			p.Logger.Printf("encode response: %v", err)
+			return
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.Write(append(data, '\n'))
+	}
+
+	dec := json.NewDecoder(conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeParseError, Message: err.Error()}})
+			}
+			return
+		}
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '[' {
+			var batch []request
+			if err := json.Unmarshal(raw, &batch); err != nil {
+				write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeInvalidRequest, Message: err.Error()}})
+				continue
+			}
+			if len(batch) == 0 {
+				write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeInvalidRequest, Message: "empty batch"}})
+				continue
+			}
+			if !p.start(len(batch)) {
+				return
+			}
+			go func() {
+				if out := p.handleBatch(batch); len(out) > 0 {
+					write(out)
+				}
+			}()
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(raw, &req); err != nil {
+			write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: CodeInvalidRequest, Message: err.Error()}})
+			continue
+		}
+		if req.Method == "shutdown" {
+			p.Logger.Printf("shutdown requested")
+			if !req.isNotification() {
+				write(response{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage("null")})
+			}
+			p.Shutdown()
+			return
+		}
+		if !p.start(1) {
+			return
+		}
+		go func() {
+			if resp, ok := p.handle(req); ok {
+				write(resp)
+			}
+		}()
+	}
+}
+
+// start counts n requests as in flight unless the plugin is stopping.
+func (p *Plugin) start(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping {
+		return false
+	}
+	p.inflight.Add(n)
+	return true
+}
+
+func (p *Plugin) handleBatch(batch []request) []response {
+	results := make([]response, len(batch))
+	answered := make([]bool, len(batch))
+	var wg sync.WaitGroup
+	for i, req := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], answered[i] = p.handle(req)
+		}()
+	}
+	wg.Wait()
+	var out []response
+	for i, ok := range answered {
+		if ok {
+			out = append(out, results[i])
+		}
+	}
+	return out
+}
+
+// handle serves one request. It reports false for notifications, which
+// get no response.
+func (p *Plugin) handle(req request) (response, bool) {
+	defer p.inflight.Done()
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	result, rpcErr := p.dispatch(req)
+	if rpcErr != nil {
+		if req.isNotification() {
+			p.Logger.Printf("%s: %s", req.Method, rpcErr.Message)
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp, !req.isNotification()
+}
+
+func (p *Plugin) dispatch(req request) (result json.RawMessage, rpcErr *Error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.Logger.Printf("%s: panic: %v", req.Method, r)
+			rpcErr = &Error{Code: CodeInternalError, Message: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	if req.Method == "on_ping" {
+		return json.RawMessage(`"pong"`), nil
+	}
+	h, ok := p.handlers[HookType(req.Method)]
+	if !ok {
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("unknown method %q", req.Method)}
+	}
+	var payload Payload
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &payload); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+		}
+	}
+	if payload.Type == "" {
+		payload.Type = HookType(req.Method)
+	}
+	reply, err := h(p.ctx, &payload)
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	if reply == nil {
+		return json.RawMessage("null"), nil
+	}
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return nil, &Error{Code: CodeInternalError, Message: err.Error()}
+	}
+	return data, nil
+}